@@ -0,0 +1,223 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var accessFormat string // Output format of the access report
+
+// accessRule is a rule of a policy matching the path being looked up.
+type accessRule struct {
+	Policy       string   `json:"policy"`
+	Rule         string   `json:"rule"`
+	Capabilities []string `json:"capabilities"`
+	Priority     int      `json:"priority"` // 1 for the rules vault applies, higher for the rules they shadow
+}
+
+// byGrantPriority sorts the rules of several policies from the one vault
+// prefers down, rules for the same path by policy name.
+type byGrantPriority []grant
+
+func (b byGrantPriority) Len() int      { return len(b) }
+func (b byGrantPriority) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byGrantPriority) Less(i, j int) bool {
+	if !b[i].Rule.samePath(b[j].Rule) {
+		return b[j].Rule.lowerPriority(b[i].Rule)
+	}
+	return b[i].Policy < b[j].Policy
+}
+
+// accessReport answers who can do what on a single path.
+type accessReport struct {
+	Path         string              `json:"path"`
+	Capabilities map[string][]string `json:"capabilities"` // capability to the policies granting it
+	Rules        []accessRule        `json:"rules"`
+	AttachedBy   map[string][]string `json:"attached_by"` // policy to the roles attaching it
+	Errors       []crawlError        `json:"errors,omitempty"`
+}
+
+// computeAccess works out which policies grant each capability on path, and
+// which roles attach those policies. The matching rules of all the policies
+// are ranked together, the way vault merges them: the rules written for the
+// most specific path come first and are the only ones that grant anything.
+func computeAccess(path string, policies []*aclPolicy, roles []authRole) accessReport {
+	path = strings.TrimPrefix(path, "/")
+	rep := accessReport{Path: path, Capabilities: map[string][]string{}, Rules: []accessRule{}, AttachedBy: map[string][]string{}}
+	var matching []grant
+	for _, p := range policies {
+		for _, r := range p.matching(path) {
+			matching = append(matching, grant{p.Name, r})
+		}
+	}
+	sort.Sort(byGrantPriority(matching))
+	priority := 0
+	for i, g := range matching {
+		if i == 0 || !g.Rule.samePath(matching[i-1].Rule) {
+			priority++
+		}
+		rep.Rules = append(rep.Rules, accessRule{g.Policy, g.Rule.Path, g.Rule.Capabilities, priority})
+	}
+
+	grants := policyGrants(policies, path)
+	denied := len(grants) > 0 && effectiveCapabilities(grants)[0] == "deny"
+	for _, g := range grants {
+		for _, c := range g.Rule.Capabilities {
+			if denied == (c == "deny") {
+				rep.Capabilities[c] = append(rep.Capabilities[c], g.Policy)
+			}
+		}
+		if _, ok := rep.AttachedBy[g.Policy]; ok {
+			continue
+		}
+		rep.AttachedBy[g.Policy] = []string{}
+		for _, role := range roles {
+			if role.attaches(g.Policy) || (g.Policy == "default" && role.Default) {
+				rep.AttachedBy[g.Policy] = append(rep.AttachedBy[g.Policy], role.String())
+			}
+		}
+	}
+	return rep
+}
+
+// accessText writes the report as aligned plain text.
+func accessText(w io.Writer, rep accessReport) error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Access to %s\n", rep.Path)
+	fmt.Fprintln(tw, "\nCapability\tPolicies")
+	for _, c := range capabilityOrder {
+		if ps, ok := rep.Capabilities[c]; ok {
+			fmt.Fprintf(tw, "%s\t%s\n", c, strings.Join(ps, ", "))
+		}
+	}
+	fmt.Fprintln(tw, "\nPolicy\tRule\tCapabilities\tPriority")
+	for _, r := range rep.Rules {
+		note := ""
+		if r.Priority > 1 {
+			note = " (shadowed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d%s\n", r.Policy, r.Rule, strings.Join(r.Capabilities, ","), r.Priority, note)
+	}
+	fmt.Fprintln(tw, "\nPolicy\tAttached by")
+	for _, p := range sortedPolicies(rep.AttachedBy) {
+		by := rep.AttachedBy[p]
+		if len(by) == 0 {
+			by = []string{"nothing"}
+		}
+		for _, r := range by {
+			fmt.Fprintf(tw, "%s\t%s\n", p, r)
+		}
+	}
+	if len(rep.Errors) > 0 {
+		fmt.Fprintln(tw, "\nCould not read\tError")
+		for _, e := range rep.Errors {
+			fmt.Fprintf(tw, "%s\t%s\n", e.Path, strings.Replace(e.Error, "\n", " ", -1))
+		}
+	}
+	tw.Flush()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeAccess writes the report in the given format, text or json.
+func writeAccess(w io.Writer, rep accessReport, f string) error {
+	switch f {
+	case "text":
+		return accessText(w, rep)
+	case "json":
+		out, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	return fmt.Errorf("unknown access format %q", f)
+}
+
+// sortedPolicies returns the policy names of the map in order.
+func sortedPolicies(m map[string][]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// accessCmd represents the access command
+var accessCmd = &cobra.Command{
+	Use:   "access <path>",
+	Short: "List the policies and roles giving access to a path",
+	Long: `List every policy granting each capability on a path, every matching rule ranked across the policies, and
+the auth method roles, token roles and identity groups attaching those policies. Folders are given with a trailing
+slash, as vault checks them when they are listed.`,
+	Run: func(access *cobra.Command, args []string) {
+		var rep accessReport
+		var err error
+		if len(args) != 1 {
+			err = fmt.Errorf("access takes exactly one path")
+		} else {
+			cli := vaultClient()
+			var roles []authRole
+			var errs []crawlError
+			roles, errs, err = fetchAuthRoles(cli)
+			if err == nil {
+				rep = computeAccess(args[0], loadPolicies(), roles)
+				rep.Errors = errs
+				err = writeAccess(os.Stdout, rep, accessFormat)
+			}
+		}
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  accessFormat,
+				"error":   err,
+			}).Error(`Could not write the access report`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  accessFormat,
+				"error":   err,
+			}).Error(`Could not write the access report`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(accessCmd)
+	accessCmd.Flags().StringVar(&accessFormat, "format", "text", "report format (text, json)")
+}
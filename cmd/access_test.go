@@ -0,0 +1,77 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestComputeAccess(t *testing.T) {
+
+	Convey("When looking up who can access a path", t, func() {
+		app, _ := parsePolicy("app", testPolicy)
+		ops, _ := parsePolicy("ops", `path "secret/*" { capabilities = ["list", "read"] }`)
+		none, _ := parsePolicy("none", `path "sys/*" { capabilities = ["read"] }`)
+		def, _ := parsePolicy("default", `path "secret/app/+/db" { capabilities = ["list"] }`)
+		roles := []authRole{
+			{"auth/approle/", "approle", "role", "web", []string{"app"}, true},
+			{"identity/", "identity", "group", "ops", []string{"ops", "none"}, false},
+		}
+		rep := computeAccess("/secret/app/web/db", []*aclPolicy{app, def, none, ops}, roles)
+
+		Convey("Each capability should list the policies whose rule vault applies", func() {
+			So(rep.Path, should.Equal, "secret/app/web/db")
+			So(rep.Capabilities["read"], should.Resemble, []string{"app"})
+			So(rep.Capabilities["update"], should.Resemble, []string{"app"})
+			So(rep.Capabilities["list"], should.Resemble, []string{"default"})
+		})
+		Convey("Every matching rule should be ranked across all policies", func() {
+			So(rep.Rules, should.Resemble, []accessRule{
+				{"app", "secret/app/+/db", []string{"read", "update"}, 1},
+				{"default", "secret/app/+/db", []string{"list"}, 1},
+				{"app", "secret/app/*", []string{"read", "list"}, 2},
+				{"ops", "secret/*", []string{"read", "list"}, 3},
+			})
+		})
+		Convey("The roles attaching the applied policies should be resolved", func() {
+			So(rep.AttachedBy["app"], should.Resemble, []string{"auth/approle/role web"})
+			So(rep.AttachedBy["default"], should.Resemble, []string{"auth/approle/role web"})
+			So(rep.AttachedBy, should.NotContainKey, "none")
+			So(rep.AttachedBy, should.NotContainKey, "ops")
+		})
+		Convey("The text report should mark shadowed rules", func() {
+			var b bytes.Buffer
+			So(writeAccess(&b, rep, "text"), should.BeNil)
+			So(b.String(), should.ContainSubstring, "(shadowed)")
+			So(b.String(), should.ContainSubstring, "ops      secret/*         read,list     3 (shadowed)")
+		})
+	})
+
+	Convey("A deny in the applied rules should be the only capability reported", t, func() {
+		app, _ := parsePolicy("app", `path "secret/x" { capabilities = ["read"] }`)
+		deny, _ := parsePolicy("deny", `path "secret/x" { capabilities = ["deny"] }`)
+		rep := computeAccess("secret/x", []*aclPolicy{app, deny}, nil)
+		So(rep.Capabilities, should.Resemble, map[string][]string{"deny": {"deny"}})
+	})
+}
@@ -0,0 +1,348 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Sizes of the area charts in pixels.
+const (
+	treemapWidth   = 1200
+	treemapHeight  = 800
+	treemapHeader  = 16 // room left at the top of a folder for its label
+	sunburstSize   = 900
+	sunburstCenter = 60 // radius of the circle drawn for the root
+)
+
+// areaColors are the fills used by the treemap and sunburst, one per group.
+var areaColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+// rect is an area of the treemap.
+type rect struct {
+	x, y, w, h float64
+}
+
+// areaWeight returns the number of visible secrets below node. Folders cut off
+// by --depth count all of their secrets so the areas still add up.
+func areaWeight(v view, node *secret) float64 {
+	children := v.children(node)
+	if len(children) == 0 {
+		return float64(node.leafCount())
+	}
+	w := 0.0
+	for _, child := range children {
+		w += areaWeight(v, child)
+	}
+	return w
+}
+
+// weighted is a node with its area weight, sortable from heaviest to lightest.
+type weighted struct {
+	node   *secret
+	weight float64
+}
+
+type byWeight []weighted
+
+func (b byWeight) Len() int           { return len(b) }
+func (b byWeight) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byWeight) Less(i, j int) bool { return b[i].weight > b[j].weight }
+
+// weightedChildren returns the visible children of node that hold at least
+// one secret, heaviest first.
+func weightedChildren(v view, node *secret) []weighted {
+	var out []weighted
+	for _, child := range v.children(node) {
+		if w := areaWeight(v, child); w > 0 {
+			out = append(out, weighted{child, w})
+		}
+	}
+	sort.Stable(byWeight(out))
+	return out
+}
+
+// owner returns the owner annotation of the node or its closest parent, or
+// the first level folder the node sits in when nobody set one.
+func owner(node *secret) string {
+	for p := node; p != nil; p = p.parent {
+		if o := p.annotations["owner"]; o != "" {
+			return o
+		}
+	}
+	for p := node; p != nil; p = p.parent {
+		if p.depth() == 1 {
+			return p.name()
+		}
+	}
+	return node.mount()
+}
+
+// areaGroups hands out a colour per group key in order of first use.
+type areaGroups map[string]int
+
+// newAreaGroups returns the colour groups for --fill-by, which must be owner,
+// mount or depth.
+func newAreaGroups() (areaGroups, error) {
+	switch fillBy {
+	case "owner", "mount", "depth":
+		return areaGroups{}, nil
+	}
+	return nil, fmt.Errorf("unknown fill mode %q", fillBy)
+}
+
+// fill returns the colour of the group the node belongs to under --fill-by.
+func (g areaGroups) fill(node *secret) string {
+	key := node.mount()
+	switch fillBy {
+	case "owner":
+		key = owner(node)
+	case "depth":
+		key = fmt.Sprint(node.depth())
+	}
+	i, ok := g[key]
+	if !ok {
+		i = len(g)
+		g[key] = i
+	}
+	return areaColors[i%len(areaColors)]
+}
+
+// worst returns the worst aspect ratio of the areas laid out in a row along
+// a side of the given length, as used by the squarified treemap algorithm.
+func worst(areas []float64, side float64) float64 {
+	s := 0.0
+	for _, a := range areas {
+		s += a
+	}
+	m := 0.0
+	for _, a := range areas {
+		r := math.Max(side*side*a/(s*s), s*s/(side*side*a))
+		if r > m {
+			m = r
+		}
+	}
+	return m
+}
+
+// squarify divides r into one rectangle per area, in order, keeping each as
+// close to square as possible. The areas must add up to the area of r.
+func squarify(areas []float64, r rect) []rect {
+	out := make([]rect, 0, len(areas))
+	for len(areas) > 0 {
+		side := math.Min(r.w, r.h)
+		n := 1
+		for n < len(areas) && worst(areas[:n+1], side) <= worst(areas[:n], side) {
+			n++
+		}
+		sum := 0.0
+		for _, a := range areas[:n] {
+			sum += a
+		}
+		if r.w >= r.h {
+			colW := 0.0
+			if r.h > 0 {
+				colW = sum / r.h
+			}
+			y := r.y
+			for _, a := range areas[:n] {
+				h := 0.0
+				if colW > 0 {
+					h = a / colW
+				}
+				out = append(out, rect{r.x, y, colW, h})
+				y += h
+			}
+			r.x += colW
+			r.w -= colW
+		} else {
+			rowH := 0.0
+			if r.w > 0 {
+				rowH = sum / r.w
+			}
+			x := r.x
+			for _, a := range areas[:n] {
+				w := 0.0
+				if rowH > 0 {
+					w = a / rowH
+				}
+				out = append(out, rect{x, r.y, w, rowH})
+				x += w
+			}
+			r.y += rowH
+			r.h -= rowH
+		}
+		areas = areas[n:]
+	}
+	return out
+}
+
+// treemapOut writes the keyspace as an svg treemap, with each folder sized by
+// the number of secrets below it.
+func treemapOut(w io.Writer, root *secret, v view) error {
+	groups, err := newAreaGroups()
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"sans-serif\" font-size=\"11\">\n", treemapWidth, treemapHeight)
+
+	var draw func(node *secret, r rect)
+	draw = func(node *secret, r rect) {
+		fill := "#ffffff"
+		if node.parent != nil {
+			fill = groups.fill(node)
+		}
+		fmt.Fprintf(&b, "<g><title>%s (%s)</title>", xmlEscape(node.path), secretCount(int(areaWeight(v, node))))
+		fmt.Fprintf(&b, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\" fill-opacity=\"0.35\" stroke=\"#ffffff\"/>", r.x, r.y, r.w, r.h, fill)
+		if r.w > 60 && r.h > treemapHeader {
+			fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%.1f\">%s</text>", r.x+3, r.y+12, xmlEscape(node.name()))
+		}
+		b.WriteString("</g>\n")
+
+		children := weightedChildren(v, node)
+		if len(children) == 0 {
+			return
+		}
+		inner := rect{r.x + 2, r.y + treemapHeader, r.w - 4, r.h - treemapHeader - 2}
+		if inner.w <= 0 || inner.h <= 0 {
+			return
+		}
+		total := 0.0
+		for _, c := range children {
+			total += c.weight
+		}
+		areas := make([]float64, len(children))
+		for i, c := range children {
+			areas[i] = c.weight / total * inner.w * inner.h
+		}
+		for i, cr := range squarify(areas, inner) {
+			draw(children[i].node, cr)
+		}
+	}
+	draw(root, rect{0, 0, treemapWidth, treemapHeight})
+
+	b.WriteString("</svg>\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// arcPath returns an svg path for the ring segment between two radii and two
+// angles, in radians clockwise from twelve o'clock. A full turn is drawn as
+// two half circles each way, as an arc ending where it starts draws nothing.
+func arcPath(c, r0, r1, a0, a1 float64) string {
+	pt := func(r, a float64) (float64, float64) {
+		return c + r*math.Sin(a), c - r*math.Cos(a)
+	}
+	if a1-a0 >= 2*math.Pi-1e-9 {
+		ring := func(r float64, sweep int) string {
+			x0, y0 := pt(r, a0)
+			x1, y1 := pt(r, a0+math.Pi)
+			return fmt.Sprintf("M%.2f %.2fA%.2f %.2f 0 1 %d %.2f %.2fA%.2f %.2f 0 1 %d %.2f %.2fZ",
+				x0, y0, r, r, sweep, x1, y1, r, r, sweep, x0, y0)
+		}
+		return ring(r1, 1) + ring(r0, 0)
+	}
+	large := 0
+	if a1-a0 > math.Pi {
+		large = 1
+	}
+	x0, y0 := pt(r1, a0)
+	x1, y1 := pt(r1, a1)
+	x2, y2 := pt(r0, a1)
+	x3, y3 := pt(r0, a0)
+	return fmt.Sprintf("M%.2f %.2fA%.2f %.2f 0 %d 1 %.2f %.2fL%.2f %.2fA%.2f %.2f 0 %d 0 %.2f %.2fZ",
+		x0, y0, r1, r1, large, x1, y1, x2, y2, r0, r0, large, x3, y3)
+}
+
+// secretCount reads n as a number of secrets.
+func secretCount(n int) string {
+	if n == 1 {
+		return "1 secret"
+	}
+	return fmt.Sprintf("%d secrets", n)
+}
+
+// treeHeight returns the number of visible levels below node.
+func treeHeight(v view, node *secret) int {
+	h := 0
+	for _, child := range v.children(node) {
+		if ch := treeHeight(v, child) + 1; ch > h {
+			h = ch
+		}
+	}
+	return h
+}
+
+// sunburstOut writes the keyspace as a self contained html page holding an
+// svg sunburst. Each ring is one level of the tree and the angle a node covers
+// is its share of the secrets.
+func sunburstOut(w io.Writer, root *secret, v view) error {
+	groups, err := newAreaGroups()
+	if err != nil {
+		return err
+	}
+	c := float64(sunburstSize) / 2
+	ring := 0.0
+	if h := treeHeight(v, root); h > 0 {
+		ring = (c - sunburstCenter - 10) / float64(h)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", xmlEscape(root.path))
+	b.WriteString("<style>body{font-family:sans-serif}path:hover{fill-opacity:1}</style>\n</head>\n<body>\n")
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-size=\"10\" text-anchor=\"middle\">\n", sunburstSize, sunburstSize)
+	fmt.Fprintf(&b, "<g><title>%s (%s)</title><circle cx=\"%.1f\" cy=\"%.1f\" r=\"%d\" fill=\"#eeeeee\"/>", xmlEscape(root.path), secretCount(int(areaWeight(v, root))), c, c, sunburstCenter)
+	fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%.1f\">%s</text></g>\n", c, c+4, xmlEscape(root.name()))
+
+	var draw func(node *secret, level int, a0, a1 float64)
+	draw = func(node *secret, level int, a0, a1 float64) {
+		children := weightedChildren(v, node)
+		total := 0.0
+		for _, ch := range children {
+			total += ch.weight
+		}
+		r0 := sunburstCenter + float64(level)*ring
+		r1 := r0 + ring
+		a := a0
+		for _, ch := range children {
+			span := (a1 - a0) * ch.weight / total
+			fmt.Fprintf(&b, "<g><title>%s (%s)</title>", xmlEscape(ch.node.path), secretCount(int(ch.weight)))
+			fmt.Fprintf(&b, "<path d=\"%s\" fill=\"%s\" fill-opacity=\"0.8\" stroke=\"#ffffff\"/>", arcPath(c, r0, r1, a, a+span), groups.fill(ch.node))
+			mid := (r0 + r1) / 2
+			if span*mid > 40 && ring > 12 {
+				fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%.1f\">%s</text>", c+mid*math.Sin(a+span/2), c-mid*math.Cos(a+span/2)+3, xmlEscape(ch.node.name()))
+			}
+			b.WriteString("</g>\n")
+			draw(ch.node, level+1, a, a+span)
+			a += span
+		}
+	}
+	draw(root, 0, 0, 2*math.Pi)
+
+	b.WriteString("</svg>\n</body>\n</html>\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,123 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSquarify(t *testing.T) {
+
+	Convey("When dividing a 6 by 4 rectangle into areas of 6, 6, 4, 3, 2, 2 and 1", t, func() {
+		rects := squarify([]float64{6, 6, 4, 3, 2, 2, 1}, rect{0, 0, 6, 4})
+
+		Convey("There should be one rectangle per area", func() {
+			So(len(rects), should.Equal, 7)
+		})
+		Convey("Each rectangle should have the requested area and stay inside the bounds", func() {
+			for i, a := range []float64{6, 6, 4, 3, 2, 2, 1} {
+				r := rects[i]
+				So(math.Abs(r.w*r.h-a), should.BeLessThan, 1e-9)
+				So(r.x+r.w, should.BeLessThanOrEqualTo, 6+1e-9)
+				So(r.y+r.h, should.BeLessThanOrEqualTo, 4+1e-9)
+			}
+		})
+		Convey("The first two areas should be laid out as squares side by side", func() {
+			So(rects[0], should.Resemble, rect{0, 0, 3, 2})
+			So(rects[1], should.Resemble, rect{0, 2, 3, 2})
+		})
+	})
+}
+
+func TestOwner(t *testing.T) {
+
+	Convey("When no node carries an owner annotation", t, func() {
+		root := testTree()
+
+		Convey("The owner should be the first level folder", func() {
+			So(owner(root.children[0].children[0]), should.Equal, "app-1")
+		})
+	})
+
+	Convey("When a folder carries an owner annotation", t, func() {
+		root := testTree()
+		root.children[1].annotations = map[string]string{"owner": "platform"}
+
+		Convey("Every key below it should belong to that owner", func() {
+			So(owner(root.children[1].children[0]), should.Equal, "platform")
+		})
+	})
+}
+
+func TestAreaOutputs(t *testing.T) {
+
+	Convey("When drawing the test tree as a treemap", t, func() {
+		var b bytes.Buffer
+		treemapOut(&b, testTree(), view{})
+
+		Convey("There should be an svg rectangle for every key", func() {
+			So(b.String(), should.StartWith, "<svg")
+			So(strings.Count(b.String(), "<rect"), should.Equal, 6)
+		})
+		Convey("Folders should be titled with their number of secrets", func() {
+			So(b.String(), should.ContainSubstring, "<title>secret/app-1 (2 secrets)</title>")
+		})
+	})
+
+	Convey("When drawing the test tree as a sunburst", t, func() {
+		var b bytes.Buffer
+		sunburstOut(&b, testTree(), view{})
+
+		Convey("The output should be a self contained html page", func() {
+			So(b.String(), should.StartWith, "<!DOCTYPE html>")
+			So(b.String(), should.NotContainSubstring, "<script")
+		})
+		Convey("There should be a ring segment for every key below the root", func() {
+			So(strings.Count(b.String(), "<path"), should.Equal, 5)
+		})
+	})
+
+	Convey("When drawing a root whose single child holds every secret as a sunburst", t, func() {
+		var b bytes.Buffer
+		sunburstOut(&b, buildTree("secret/app/", "secret/app/db"), view{})
+
+		Convey("The full ring should be drawn as two half circles", func() {
+			So(b.String(), should.ContainSubstring, "M450.00 200.00A250.00 250.00 0 1 1 450.00 700.00A250.00 250.00 0 1 1 450.00 200.00Z")
+			So(b.String(), should.ContainSubstring, "M450.00 390.00A60.00 60.00 0 1 0 450.00 510.00A60.00 60.00 0 1 0 450.00 390.00Z")
+		})
+		Convey("A single secret should not be titled in the plural", func() {
+			So(b.String(), should.ContainSubstring, "<title>secret/app (1 secret)</title>")
+		})
+	})
+
+	Convey("An unknown --fill-by should be an error", t, func() {
+		fillBy = "ownr"
+		defer func() { fillBy = "owner" }()
+		var b bytes.Buffer
+		So(treemapOut(&b, testTree(), view{}), should.NotBeNil)
+		So(sunburstOut(&b, testTree(), view{}), should.NotBeNil)
+	})
+}
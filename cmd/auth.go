@@ -0,0 +1,199 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	"sort"
+	"strings"
+)
+
+// roleSource is a list of entities an auth method attaches policies through.
+type roleSource struct {
+	Kind   string   // what the entities are called: role, user or group
+	List   string   // path below the mount listing them
+	Fields []string // fields of an entity naming its policies
+}
+
+// roleSources are the entities read for each supported auth method type.
+var roleSources = map[string][]roleSource{
+	"approle":    {{"role", "role", []string{"token_policies", "policies"}}},
+	"kubernetes": {{"role", "role", []string{"token_policies", "policies"}}},
+	"userpass":   {{"user", "users", []string{"token_policies", "policies"}}},
+	"ldap": {
+		{"group", "groups", []string{"policies"}},
+		{"user", "users", []string{"policies"}},
+	},
+	"token": {{"token role", "roles", []string{"token_policies", "policies"}}},
+}
+
+// authRole is anything that attaches policies to the tokens it hands out:
+// an auth method role, user or group, a token role or an identity group.
+type authRole struct {
+	Mount    string   `json:"mount"` // e.g. auth/approle/, or identity/ for identity groups
+	Type     string   `json:"type"`  // auth method type, or identity
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Policies []string `json:"policies"`
+	Default  bool     `json:"default_policy"` // its tokens also get the default policy
+}
+
+// String names the role the way it is shown in reports.
+func (r authRole) String() string {
+	return fmt.Sprintf("%s%s %s", r.Mount, r.Kind, r.Name)
+}
+
+// attaches reports whether the role attaches the policy.
+func (r authRole) attaches(policy string) bool {
+	for _, p := range r.Policies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList reads a field holding either a list of strings or a comma
+// separated string, as different vault versions return policies.
+func stringList(v interface{}) []string {
+	var out []string
+	switch l := v.(type) {
+	case []interface{}:
+		for _, s := range l {
+			if s, ok := s.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+	case string:
+		for _, s := range strings.Split(l, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// getsDefault reports whether the tokens handed out by an entity of the
+// given mount type, read as data, also get the default policy. Identity groups
+// hand out no tokens; everything else does unless it opts out.
+func getsDefault(mountType string, data map[string]interface{}) bool {
+	if mountType == "identity" {
+		return false
+	}
+	noDefault, _ := data["token_no_default_policy"].(bool)
+	legacy, _ := data["no_default_policy"].(bool)
+	return !noDefault && !legacy
+}
+
+// listNames returns the keys listed at path, empty when there are none.
+func listNames(cli *api.Client, path string) ([]string, error) {
+	s, err := cli.Logical().List(path)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	return stringList(s.Data["keys"]), nil
+}
+
+// readRoles reads every entity listed at base+list and the policies in their
+// fields. Entities that can not be read are reported and skipped.
+func readRoles(cli *api.Client, base, mountType string, src roleSource) ([]authRole, []crawlError) {
+	var out []authRole
+	var errs []crawlError
+	names, err := listNames(cli, base+src.List)
+	if err != nil {
+		return nil, []crawlError{{base + src.List, err.Error()}}
+	}
+	for _, name := range names {
+		path := base + src.List + "/" + name
+		s, err := cli.Logical().Read(path)
+		if err != nil {
+			errs = append(errs, crawlError{path, err.Error()})
+			continue
+		}
+		role := authRole{Mount: base, Type: mountType, Kind: src.Kind, Name: name, Default: getsDefault(mountType, nil)}
+		if s != nil {
+			role.Default = getsDefault(mountType, s.Data)
+			seen := map[string]bool{}
+			for _, f := range src.Fields {
+				for _, p := range stringList(s.Data[f]) {
+					if !seen[p] {
+						seen[p] = true
+						role.Policies = append(role.Policies, p)
+					}
+				}
+			}
+		}
+		sort.Strings(role.Policies)
+		out = append(out, role)
+	}
+	return out, errs
+}
+
+// authMount is an enabled auth method.
+type authMount struct {
+	Path string // e.g. auth/approle/
+	Type string
+}
+
+// fetchAuthMounts lists the enabled auth methods, sorted by path.
+func fetchAuthMounts(cli *api.Client) ([]authMount, error) {
+	mounts, err := cli.Sys().ListAuth()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the auth methods: %s", err)
+	}
+	var paths []string
+	for p := range mounts {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	out := make([]authMount, len(paths))
+	for i, p := range paths {
+		out[i] = authMount{"auth/" + p, mounts[p].Type}
+	}
+	return out, nil
+}
+
+// fetchAuthRoles reads the roles of every enabled auth method vault knows how
+// to read, the token roles and the identity groups. Only failing to list the
+// auth methods is an error; anything else unreadable is returned with the
+// path it was read from.
+func fetchAuthRoles(cli *api.Client) ([]authRole, []crawlError, error) {
+	mounts, err := fetchAuthMounts(cli)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var roles []authRole
+	var errs []crawlError
+	for _, m := range mounts {
+		for _, src := range roleSources[m.Type] {
+			r, e := readRoles(cli, m.Path, m.Type, src)
+			roles = append(roles, r...)
+			errs = append(errs, e...)
+		}
+	}
+	r, e := readRoles(cli, "identity/", "identity", roleSource{"group", "group/name", []string{"policies"}})
+	roles = append(roles, r...)
+	errs = append(errs, e...)
+	return roles, errs, nil
+}
@@ -0,0 +1,87 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/hashicorp/vault/api"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// authServer serves an approle mount with two roles, a token role, an
+// unsupported github mount and an identity group.
+func authServer() *httptest.Server {
+	responses := map[string]interface{}{
+		"/v1/sys/auth": map[string]interface{}{
+			"approle/": map[string]interface{}{"type": "approle"},
+			"github/":  map[string]interface{}{"type": "github"},
+			"token/":   map[string]interface{}{"type": "token"},
+		},
+		"/v1/auth/approle/role":          map[string]interface{}{"data": map[string]interface{}{"keys": []string{"web", "db"}}},
+		"/v1/auth/approle/role/web":      map[string]interface{}{"data": map[string]interface{}{"token_policies": []string{"web", "default"}}},
+		"/v1/auth/approle/role/db":       map[string]interface{}{"data": map[string]interface{}{"policies": "db,ops", "token_no_default_policy": true}},
+		"/v1/auth/token/roles":           map[string]interface{}{"data": map[string]interface{}{"keys": []string{"ci"}}},
+		"/v1/auth/token/roles/ci":        map[string]interface{}{"data": map[string]interface{}{"allowed_policies": []string{"admin", "ops"}, "token_policies": []string{"ops"}}},
+		"/v1/identity/group/name":        map[string]interface{}{"data": map[string]interface{}{"keys": []string{"admins"}}},
+		"/v1/identity/group/name/admins": map[string]interface{}{"data": map[string]interface{}{"policies": []string{"admin"}}},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestFetchAuthRoles(t *testing.T) {
+
+	Convey("When reading the roles of the enabled auth methods", t, func() {
+		ts := authServer()
+		defer ts.Close()
+		cfg := api.DefaultConfig()
+		cfg.Address = ts.URL
+		cli, _ := api.NewClient(cfg)
+		roles, errs, err := fetchAuthRoles(cli)
+
+		Convey("No error should be returned", func() {
+			So(err, should.BeNil)
+			So(errs, should.BeEmpty)
+		})
+		Convey("Roles of supported methods, token roles and identity groups should be found", func() {
+			So(roles, should.Resemble, []authRole{
+				{"auth/approle/", "approle", "role", "web", []string{"default", "web"}, true},
+				{"auth/approle/", "approle", "role", "db", []string{"db", "ops"}, false},
+				{"auth/token/", "token", "token role", "ci", []string{"ops"}, true},
+				{"identity/", "identity", "group", "admins", []string{"admin"}, false},
+			})
+		})
+		Convey("Roles should be named by their mount and kind", func() {
+			So(roles[2].String(), should.Equal, "auth/token/token role ci")
+			So(roles[1].attaches("ops"), should.BeTrue)
+		})
+	})
+}
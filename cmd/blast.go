@@ -0,0 +1,449 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	gph "github.com/awalterschulze/gographviz"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var blastFormat string  // Output format of the blast radius ranking
+var blastTop int        // Number of policies and roles ranked, 0 for all
+var blastSkipRoles bool // Rank the policies without reading the auth roles from vault
+
+// defaultSensitiveWeight is what a secret below a sensitive prefix counts
+// for when the config gives no weight.
+const defaultSensitiveWeight = 10
+
+// heatLevels is the number of colours in the ylorrd colour scheme used to
+// draw the ranking.
+const heatLevels = 9
+
+// sensitivePrefix marks a subtree whose secrets weigh more in the score.
+type sensitivePrefix struct {
+	Prefix string  `json:"prefix" mapstructure:"prefix"`
+	Weight float64 `json:"weight" mapstructure:"weight"`
+}
+
+// sensitiveReach counts the secrets below a sensitive prefix a policy or
+// role can read and write.
+type sensitiveReach struct {
+	Prefix string `json:"prefix"`
+	Read   int    `json:"read"`
+	Write  int    `json:"write"`
+}
+
+// blastRadius is what leaking a credential carrying a policy, or issued by
+// a role, exposes.
+type blastRadius struct {
+	Kind      string           `json:"kind"` // policy or role
+	Name      string           `json:"name"`
+	Policies  []string         `json:"policies,omitempty"` // the policies a role attaches, with default when its tokens get it
+	Read      int              `json:"read"`               // secrets it can read
+	Write     int              `json:"write"`              // secrets it can create, update or delete
+	Score     float64          `json:"score"`
+	Sensitive []sensitiveReach `json:"sensitive"`
+}
+
+// blastReport ranks the policies and roles by their blast radius.
+type blastReport struct {
+	Secrets      int               `json:"secrets"`
+	Sensitive    []sensitivePrefix `json:"sensitive_prefixes"`
+	RolesChecked bool              `json:"roles_checked"`
+	Ranking      []blastRadius     `json:"ranking"`
+	Errors       []crawlError      `json:"errors,omitempty"`
+}
+
+// byScore orders the ranking from the most to the least dangerous.
+type byScore []blastRadius
+
+func (b byScore) Len() int      { return len(b) }
+func (b byScore) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byScore) Less(i, j int) bool {
+	switch {
+	case b[i].Score != b[j].Score:
+		return b[i].Score > b[j].Score
+	case b[i].Write != b[j].Write:
+		return b[i].Write > b[j].Write
+	case b[i].Kind != b[j].Kind:
+		return b[i].Kind < b[j].Kind
+	}
+	return b[i].Name < b[j].Name
+}
+
+// sensitivePrefixes reads the list of sensitive prefixes and their weights
+// from the sensitive key of the config.
+func sensitivePrefixes() ([]sensitivePrefix, error) {
+	var out []sensitivePrefix
+	if err := viper.UnmarshalKey("sensitive", &out); err != nil {
+		return nil, fmt.Errorf("could not read the sensitive prefixes from the config: %s", err)
+	}
+	for i, s := range out {
+		if s.Prefix == "" {
+			return nil, fmt.Errorf("sensitive prefix %d has no prefix", i+1)
+		}
+		if s.Weight < 0 {
+			return nil, fmt.Errorf("sensitive prefix %q has a negative weight", s.Prefix)
+		}
+		if s.Weight == 0 {
+			out[i].Weight = defaultSensitiveWeight
+		}
+		out[i].Prefix = strings.TrimSuffix(s.Prefix, "*")
+	}
+	return out, nil
+}
+
+// secretWeight returns what the secret at path counts for: the weight of the
+// longest sensitive prefix it is below, or 1.
+func secretWeight(path string, sensitive []sensitivePrefix) float64 {
+	weight, longest := 1.0, -1
+	for _, s := range sensitive {
+		if strings.HasPrefix(path, s.Prefix) && len(s.Prefix) > longest {
+			weight, longest = s.Weight, len(s.Prefix)
+		}
+	}
+	return weight
+}
+
+// measureBlast counts the secrets caps lets a credential read and write and
+// scores them, each secret adding its weight once for read and once for write.
+func measureBlast(secrets []*secret, sensitive []sensitivePrefix, caps func(path string) []string) blastRadius {
+	b := blastRadius{Sensitive: []sensitiveReach{}}
+	reach := make([]sensitiveReach, len(sensitive))
+	for _, s := range secrets {
+		read, write := false, false
+		for _, c := range caps(s.aclPath()) {
+			switch c {
+			case "read":
+				read = true
+			case "create", "update", "delete":
+				write = true
+			}
+		}
+		if !read && !write {
+			continue
+		}
+		weight := secretWeight(s.path, sensitive)
+		if read {
+			b.Read++
+			b.Score += weight
+		}
+		if write {
+			b.Write++
+			b.Score += weight
+		}
+		for i, p := range sensitive {
+			if !strings.HasPrefix(s.path, p.Prefix) {
+				continue
+			}
+			reach[i].Prefix = p.Prefix
+			if read {
+				reach[i].Read++
+			}
+			if write {
+				reach[i].Write++
+			}
+		}
+	}
+	for _, r := range reach {
+		if r.Prefix != "" {
+			b.Sensitive = append(b.Sensitive, r)
+		}
+	}
+	return b
+}
+
+// blastRanking measures every policy and, when roles is not nil, every role
+// on the secrets below root. A role is scored on its policies, plus default
+// when its tokens get it, merged the way vault merges them, and a role
+// attaching root can do anything.
+func blastRanking(root *secret, policies []*aclPolicy, roles []authRole, sensitive []sensitivePrefix) blastReport {
+	rep := blastReport{Sensitive: sensitive, RolesChecked: roles != nil, Ranking: []blastRadius{}}
+	if rep.Sensitive == nil {
+		rep.Sensitive = []sensitivePrefix{}
+	}
+	var secrets []*secret
+	var walk func(node *secret)
+	walk = func(node *secret) {
+		if node.nodeType() == "secret" {
+			secrets = append(secrets, node)
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(root)
+	rep.Secrets = len(secrets)
+
+	byName := map[string]*aclPolicy{}
+	for _, p := range policies {
+		p := p
+		byName[p.Name] = p
+		b := measureBlast(secrets, sensitive, func(path string) []string { return granted(p, path) })
+		b.Kind, b.Name = "policy", p.Name
+		rep.Ranking = append(rep.Ranking, b)
+	}
+
+	// Roles attaching the same policies have the same blast radius.
+	measured := map[string]blastRadius{}
+	for _, r := range roles {
+		names := append([]string{}, r.Policies...)
+		if r.Default {
+			names = append(names, "default")
+		}
+		sort.Strings(names)
+		var attached []string
+		var set []*aclPolicy
+		isRoot := false
+		for i, n := range names {
+			if i > 0 && n == names[i-1] {
+				continue
+			}
+			attached = append(attached, n)
+			isRoot = isRoot || n == "root"
+			if p, ok := byName[n]; ok {
+				set = append(set, p)
+			}
+		}
+		key := strings.Join(attached, ",")
+		b, ok := measured[key]
+		if !ok {
+			b = measureBlast(secrets, sensitive, func(path string) []string {
+				if isRoot {
+					return tokenCapabilities([]string{"root"})
+				}
+				return effectiveCapabilities(policyGrants(set, path))
+			})
+			measured[key] = b
+		}
+		b.Kind, b.Name, b.Policies = "role", r.String(), attached
+		rep.Ranking = append(rep.Ranking, b)
+	}
+	sort.Sort(byScore(rep.Ranking))
+	return rep
+}
+
+// sensitiveText summarises what a ranked entry reaches below the sensitive
+// prefixes.
+func sensitiveText(reach []sensitiveReach) string {
+	var parts []string
+	for _, r := range reach {
+		parts = append(parts, fmt.Sprintf("%s (read %d, write %d)", r.Prefix, r.Read, r.Write))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// blastText writes the ranking as an aligned plain text table.
+func blastText(w io.Writer, rep blastReport) error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Blast radius over %d secrets\n", rep.Secrets)
+	fmt.Fprintln(tw, "Rank\tKind\tName\tRead\tWrite\tScore\tSensitive")
+	for i, r := range rep.Ranking {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%g\t%s\n", i+1, r.Kind, r.Name, r.Read, r.Write, r.Score, sensitiveText(r.Sensitive))
+	}
+	if !rep.RolesChecked {
+		fmt.Fprintln(tw, "\nRoles: not checked")
+	}
+	if len(rep.Errors) > 0 {
+		fmt.Fprintln(tw, "\nCould not read\tError")
+		for _, e := range rep.Errors {
+			fmt.Fprintf(tw, "%s\t%s\n", e.Path, strings.Replace(e.Error, "\n", " ", -1))
+		}
+	}
+	tw.Flush()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// heatLevel maps a score to a colour of the ylorrd scheme, the highest score
+// getting the darkest red.
+func heatLevel(score, max float64) int {
+	if max <= 0 {
+		return 1
+	}
+	return 1 + int(float64(heatLevels-1)*score/max+0.5)
+}
+
+// blastOut draws the ranking as a dot graph: roles and policies filled from
+// pale yellow to dark red by their score, roles linked to the policies they
+// attach and policies to the sensitive prefixes they reach.
+func blastOut(w io.Writer, rep blastReport) error {
+	g := gph.NewGraph()
+	g.SetDir(true)
+	g.SetName("BlastRadius")
+	g.AddAttr("BlastRadius", "rankdir", "LR")
+	columns := []string{"cluster_roles", "cluster_policies", "cluster_sensitive"}
+	labels := []string{"Roles", "Policies", "Sensitive prefixes"}
+	for i, c := range columns {
+		g.AddSubGraph("BlastRadius", c, map[string]string{"label": dotQuote(labels[i]), "style": dotQuote("dashed")})
+	}
+
+	max := 0.0
+	for _, r := range rep.Ranking {
+		if r.Score > max {
+			max = r.Score
+		}
+	}
+	for _, s := range rep.Sensitive {
+		g.AddNode("cluster_sensitive", dotQuote("sensitive:"+s.Prefix), map[string]string{
+			"label": dotQuote(fmt.Sprintf("%s\nweight %g", s.Prefix, s.Weight)),
+			"shape": "folder",
+		})
+	}
+	for _, r := range rep.Ranking {
+		level := heatLevel(r.Score, max)
+		attrs := map[string]string{
+			"label":       dotQuote(fmt.Sprintf("%s\nread %d, write %d\nscore %g", r.Name, r.Read, r.Write, r.Score)),
+			"shape":       "box",
+			"style":       "filled",
+			"colorscheme": dotQuote(fmt.Sprintf("ylorrd%d", heatLevels)),
+			"fillcolor":   dotQuote(fmt.Sprint(level)),
+		}
+		if level > heatLevels/2+1 {
+			attrs["fontcolor"] = "white"
+		}
+		if r.Kind == "policy" {
+			attrs["style"] = dotQuote("rounded,filled")
+			g.AddNode("cluster_policies", dotQuote("policy:"+r.Name), attrs)
+			for _, s := range r.Sensitive {
+				g.AddEdge(dotQuote("policy:"+r.Name), dotQuote("sensitive:"+s.Prefix), true, map[string]string{
+					"label": dotQuote(fmt.Sprintf("read %d, write %d", s.Read, s.Write)),
+				})
+			}
+		} else {
+			g.AddNode("cluster_roles", dotQuote("role:"+r.Name), attrs)
+		}
+	}
+	for _, r := range rep.Ranking {
+		if r.Kind != "role" {
+			continue
+		}
+		for _, p := range r.Policies {
+			if pid := dotQuote("policy:" + p); g.IsNode(pid) {
+				g.AddEdge(dotQuote("role:"+r.Name), pid, true, nil)
+			}
+		}
+	}
+	_, err := fmt.Fprintln(w, g.String())
+	return err
+}
+
+// writeBlast writes the ranking in the given format, text, json or dot.
+func writeBlast(w io.Writer, rep blastReport, f string) error {
+	switch f {
+	case "text":
+		return blastText(w, rep)
+	case "json":
+		out, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "dot":
+		return blastOut(w, rep)
+	}
+	return fmt.Errorf("unknown blast radius format %q", f)
+}
+
+// blastCmd represents the blast-radius command
+var blastCmd = &cobra.Command{
+	Use:   "blast-radius",
+	Short: "Rank policies and roles by how many secrets they can read or write",
+	Long: `Count, for every policy and every auth method role, token role and identity group, the secrets it can read
+and the secrets it can create, update or delete, and rank them by how dangerous leaking such a credential would be.
+Each secret adds to the score once for read and once for write; secrets below the sensitive prefixes listed in the
+config count for their weight instead of 1. The keyspace and policies come from a live crawl or a --snapshot written
+with --policies; the roles are read from vault unless --skip-roles is given. --format dot draws the ranking as a
+heat coloured graph.`,
+	Run: func(blast *cobra.Command, args []string) {
+		sensitive, err := sensitivePrefixes()
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"error":   err,
+			}).Error(`Could not use the sensitive prefixes`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"error":   err,
+			}).Error(`Could not use the sensitive prefixes`)
+			sensuutil.Exit("CONFIGERROR")
+		}
+		root := loadTree()
+		policies := keyspacePolicies()
+		var roles []authRole
+		var errs []crawlError
+		if !blastSkipRoles {
+			roles, errs, err = fetchAuthRoles(vaultClient())
+			if roles == nil && err == nil {
+				roles = []authRole{}
+			}
+		}
+		if err == nil {
+			rep := blastRanking(root, policies, roles, sensitive)
+			rep.Errors = errs
+			if blastTop > 0 && len(rep.Ranking) > blastTop {
+				rep.Ranking = rep.Ranking[:blastTop]
+			}
+			err = writeBlast(os.Stdout, rep, blastFormat)
+		}
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  blastFormat,
+				"error":   err,
+			}).Error(`Could not rank the blast radius`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  blastFormat,
+				"error":   err,
+			}).Error(`Could not rank the blast radius`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(blastCmd)
+	blastCmd.Flags().StringVar(&blastFormat, "format", "text", "ranking format (text, json, dot)")
+	blastCmd.Flags().IntVar(&blastTop, "top", 0, "only rank this many policies and roles, 0 for all of them")
+	blastCmd.Flags().BoolVar(&blastSkipRoles, "skip-roles", false, "do not read the auth roles from vault, ranking the policies only")
+}
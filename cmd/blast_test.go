@@ -0,0 +1,130 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestBlastRanking(t *testing.T) {
+
+	Convey("When ranking policies and roles by blast radius", t, func() {
+		root := buildTree("secret/app/", "secret/app/db", "secret/app/api", "secret/prod/", "secret/prod/key", "secret/top")
+		app, _ := parsePolicy("app", `path "secret/app/*" { capabilities = ["read", "list"] }`)
+		ops, _ := parsePolicy("ops", `
+path "secret/*" { capabilities = ["read", "update"] }
+path "secret/app/*" { capabilities = ["deny"] }
+`)
+		def, _ := parsePolicy("default", `path "secret/top" { capabilities = ["read"] }`)
+		roles := []authRole{
+			{"auth/approle/", "approle", "role", "web", []string{"app"}, true},
+			{"auth/approle/", "approle", "role", "both", []string{"app", "ops"}, true},
+			{"auth/userpass/", "userpass", "user", "admin", []string{"root"}, true},
+			{"identity/", "identity", "group", "ops", []string{"ops"}, false},
+		}
+		sensitive := []sensitivePrefix{{"secret/prod/", 10}}
+		rep := blastRanking(root, []*aclPolicy{app, def, ops}, roles, sensitive)
+
+		Convey("Every secret should be counted", func() {
+			So(rep.Secrets, should.Equal, 4)
+			So(rep.RolesChecked, should.BeTrue)
+		})
+		Convey("A role attaching root should rank first", func() {
+			So(rep.Ranking[0].Name, should.Equal, "auth/userpass/user admin")
+			So(rep.Ranking[0].Read, should.Equal, 4)
+			So(rep.Ranking[0].Write, should.Equal, 4)
+			So(rep.Ranking[0].Score, should.Equal, 26)
+		})
+		Convey("Secrets below a sensitive prefix should count for their weight", func() {
+			var p blastRadius
+			for _, r := range rep.Ranking {
+				if r.Name == "ops" {
+					p = r
+				}
+			}
+			So(p.Read, should.Equal, 2)
+			So(p.Write, should.Equal, 2)
+			So(p.Score, should.Equal, 22)
+			So(p.Sensitive, should.Resemble, []sensitiveReach{{"secret/prod/", 1, 1}})
+		})
+		Convey("Roles should be scored on their policies plus default, merged the way vault does", func() {
+			var both blastRadius
+			for _, r := range rep.Ranking {
+				if r.Name == "auth/approle/role both" {
+					both = r
+				}
+			}
+			So(both.Policies, should.Resemble, []string{"app", "default", "ops"})
+			So(both.Read, should.Equal, 2)
+			So(both.Write, should.Equal, 1)
+		})
+		Convey("Roles whose tokens do not get default should be scored without it", func() {
+			var group blastRadius
+			for _, r := range rep.Ranking {
+				if r.Name == "identity/group ops" {
+					group = r
+				}
+			}
+			So(group.Policies, should.Resemble, []string{"ops"})
+			So(group.Score, should.Equal, 22)
+		})
+		Convey("The text report should rank every policy and role", func() {
+			var b bytes.Buffer
+			So(writeBlast(&b, rep, "text"), should.BeNil)
+			So(b.String(), should.StartWith, "Blast radius over 4 secrets\n")
+			So(b.String(), should.ContainSubstring, "secret/prod/ (read 1, write 1)")
+		})
+		Convey("The graph should colour the highest score darkest", func() {
+			var b bytes.Buffer
+			So(writeBlast(&b, rep, "dot"), should.BeNil)
+			So(b.String(), should.ContainSubstring, "\"role:auth/userpass/user admin\"")
+			So(b.String(), should.ContainSubstring, "fillcolor=\"9\"")
+			So(b.String(), should.ContainSubstring, "\"policy:ops\"->\"sensitive:secret/prod/\"")
+		})
+	})
+
+	Convey("Heat levels should spread scores over the colour scheme", t, func() {
+		So(heatLevel(0, 0), should.Equal, 1)
+		So(heatLevel(0, 10), should.Equal, 1)
+		So(heatLevel(5, 10), should.Equal, 5)
+		So(heatLevel(10, 10), should.Equal, heatLevels)
+	})
+
+	Convey("When reading the sensitive prefixes from the config", t, func() {
+		defer viper.Set("sensitive", nil)
+
+		Convey("A missing weight should use the default and a trailing glob be dropped", func() {
+			viper.Set("sensitive", []interface{}{map[string]interface{}{"prefix": "secret/prod/*"}})
+			s, err := sensitivePrefixes()
+			So(err, should.BeNil)
+			So(s, should.Resemble, []sensitivePrefix{{"secret/prod/", defaultSensitiveWeight}})
+		})
+		Convey("An entry without a prefix should be an error", func() {
+			viper.Set("sensitive", []interface{}{map[string]interface{}{"weight": 5}})
+			_, err := sensitivePrefixes()
+			So(err, should.NotBeNil)
+		})
+	})
+}
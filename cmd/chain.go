@@ -0,0 +1,160 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	gph "github.com/awalterschulze/gographviz"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"os"
+	"sort"
+)
+
+// chainOut draws how tokens get to the keyspace: each auth mount, its roles,
+// the policies they attach, default included for the roles that get it, and
+// the subtrees those policies reach. Policies a role names that do not exist
+// are drawn dashed.
+func chainOut(w io.Writer, root *secret, v view, policies []*aclPolicy, mounts []authMount, roles []authRole) error {
+	g := gph.NewGraph()
+	g.SetDir(true)
+	g.SetName("Access")
+	g.AddAttr("Access", "rankdir", "LR")
+	columns := []string{"cluster_auth", "cluster_roles", "cluster_policies", "cluster_paths"}
+	labels := []string{"Auth methods", "Roles", "Policies", root.mount()}
+	for i, c := range columns {
+		g.AddSubGraph("Access", c, map[string]string{"label": dotQuote(labels[i]), "style": dotQuote("dashed")})
+	}
+
+	addMount := func(path, kind string) string {
+		mid := dotQuote("auth:" + path)
+		if !g.IsNode(mid) {
+			g.AddNode("cluster_auth", mid, map[string]string{"label": dotQuote(path + "\n(" + kind + ")"), "shape": "cylinder"})
+		}
+		return mid
+	}
+	for _, m := range mounts {
+		addMount(m.Path, m.Type)
+	}
+
+	byName := map[string]int{}
+	for i, p := range policies {
+		byName[p.Name] = i
+	}
+	var used []string
+	seen := map[string]bool{}
+	for _, r := range roles {
+		mid := addMount(r.Mount, r.Type)
+		rid := dotQuote("role:" + r.String())
+		g.AddNode("cluster_roles", rid, map[string]string{"label": dotQuote(r.Kind + " " + r.Name), "shape": "box"})
+		g.AddEdge(mid, rid, true, nil)
+		attached := r.Policies
+		if r.Default && !r.attaches("default") {
+			attached = append(append([]string{}, r.Policies...), "default")
+		}
+		for _, p := range attached {
+			pid := dotQuote("policy:" + p)
+			if !seen[p] {
+				seen[p] = true
+				used = append(used, p)
+				attrs := map[string]string{"label": dotQuote(p), "shape": "box", "style": "rounded"}
+				if i, ok := byName[p]; ok {
+					attrs["color"] = colorPick(i)
+				} else if p != "root" {
+					attrs["label"] = dotQuote(p + " (missing)")
+					attrs["style"] = dotQuote("rounded,dashed")
+				}
+				g.AddNode("cluster_policies", pid, attrs)
+			}
+			g.AddEdge(rid, pid, true, nil)
+		}
+	}
+
+	sort.Strings(used)
+	nodes := v.nodes(root)
+	for _, name := range used {
+		i, ok := byName[name]
+		if !ok {
+			continue
+		}
+		reachOut(g, "cluster_paths", dotQuote("policy:"+name), colorPick(i), policies[i], nodes)
+	}
+	_, err := fmt.Fprintln(w, g.String())
+	return err
+}
+
+// chainCmd represents the chain command
+var chainCmd = &cobra.Command{
+	Use:   "chain",
+	Short: "Draw the auth method, role, policy and path access chain",
+	Long: `Draw a dot graph following every enabled auth method (approle, kubernetes, ldap, userpass and token roles,
+plus identity groups) to its roles, the policies they attach, default included, and the subtrees of the keyspace those policies reach,
+showing how anything gets to a secret. The keyspace and policies come from a live crawl or a --snapshot written with
+--policies; the roles are always read from vault.`,
+	Run: func(chain *cobra.Command, args []string) {
+		root := loadTree()
+		policies := keyspacePolicies()
+		cli := vaultClient()
+		mounts, err := fetchAuthMounts(cli)
+		var roles []authRole
+		var errs []crawlError
+		if err == nil {
+			roles, errs, err = fetchAuthRoles(cli)
+		}
+		for _, e := range errs {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"path":    e.Path,
+				"error":   e.Error,
+			}).Warn(`Could not read the roles`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"path":    e.Path,
+				"error":   e.Error,
+			}).Warn(`Could not read the roles`)
+		}
+		if err == nil {
+			err = chainOut(os.Stdout, root, flagView(), policies, mounts, roles)
+		}
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"error":   err,
+			}).Error(`Could not draw the access chain`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"error":   err,
+			}).Error(`Could not draw the access chain`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(chainCmd)
+}
@@ -0,0 +1,68 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestChainOut(t *testing.T) {
+
+	Convey("When drawing the access chain", t, func() {
+		web, _ := parsePolicy("web", `path "secret/web/*" { capabilities = ["read"] }`)
+		ops, _ := parsePolicy("ops", `path "secret/*" { capabilities = ["list"] }`)
+		roles := []authRole{
+			{"auth/approle/", "approle", "role", "web", []string{"web", "gone"}, true},
+			{"auth/token/", "token", "token role", "ci", []string{"web"}, false},
+		}
+		def, _ := parsePolicy("default", `path "auth/token/lookup-self" { capabilities = ["read"] }`)
+		mounts := []authMount{{"auth/approle/", "approle"}, {"auth/ldap/", "ldap"}, {"auth/token/", "token"}}
+		root := buildTree("secret/web/", "secret/web/db", "secret/ops/")
+		var b bytes.Buffer
+		So(chainOut(&b, root, view{}, []*aclPolicy{ops, web, def}, mounts, roles), should.BeNil)
+		out := b.String()
+
+		Convey("Auth mounts should lead to their roles", func() {
+			So(out, should.ContainSubstring, "\"auth:auth/approle/\"->\"role:auth/approle/role web\"")
+			So(out, should.ContainSubstring, "\"auth:auth/token/\"->\"role:auth/token/token role ci\"")
+		})
+		Convey("Auth mounts without roles should still be drawn", func() {
+			So(out, should.ContainSubstring, "\"auth:auth/ldap/\"")
+		})
+		Convey("Roles should lead to the default policy unless they opt out", func() {
+			So(out, should.ContainSubstring, "\"role:auth/approle/role web\"->\"policy:default\"")
+			So(out, should.NotContainSubstring, "\"role:auth/token/token role ci\"->\"policy:default\"")
+		})
+		Convey("Roles should lead to their policies, missing ones dashed", func() {
+			So(out, should.ContainSubstring, "\"role:auth/token/token role ci\"->\"policy:web\"")
+			So(out, should.ContainSubstring, "label=\"gone (missing)\"")
+		})
+		Convey("Attached policies should lead to the paths they reach", func() {
+			So(out, should.ContainSubstring, "\"policy:web\"->\"secret/web\"[ color=\"blue\", label=\"read\" ]")
+		})
+		Convey("Policies no role attaches should be left out", func() {
+			So(out, should.NotContainSubstring, "policy:ops")
+		})
+	})
+}
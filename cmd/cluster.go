@@ -0,0 +1,91 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	gph "github.com/awalterschulze/gographviz"
+	"github.com/awalterschulze/gographviz/ast"
+)
+
+// clusterColors are the background colours given to folder clusters in turn.
+var clusterColors = []string{"#e8f0fe", "#e6f4ea", "#fef7e0", "#fce8e6", "#f3e8fd", "#e4f7fb"}
+
+// clusters tracks the cluster subgraphs added to a dot graph so that folder
+// clusters can be nested inside their mount once the graph is written.
+type clusters struct {
+	parents map[string]string // cluster name to the cluster it belongs in
+	order   []string
+}
+
+// clusterName returns the quoted subgraph name for the node. Graphviz only
+// draws subgraphs whose name starts with cluster as a box.
+func clusterName(node *secret) string {
+	return dotQuote("cluster_" + node.path)
+}
+
+// add creates a cluster subgraph for node inside parent and returns its name.
+func (c *clusters) add(g *gph.Graph, node *secret, parent string, fill string) string {
+	name := clusterName(node)
+	g.AddSubGraph("Vault", name, map[string]string{
+		"label":     dotQuote(node.path),
+		"style":     dotQuote("filled"),
+		"fillcolor": dotQuote(fill),
+	})
+	if c.parents == nil {
+		c.parents = map[string]string{}
+	}
+	c.parents[name] = parent
+	c.order = append(c.order, name)
+	return name
+}
+
+// nest moves every cluster that belongs in another cluster out of the top
+// level of the written graph and into its parent. gographviz only writes
+// subgraphs at the top level.
+func (c *clusters) nest(a *ast.Graph) error {
+	subs := map[string]*ast.SubGraph{}
+	for _, stmt := range a.StmtList {
+		if s, ok := stmt.(*ast.SubGraph); ok {
+			subs[s.Id.String()] = s
+		}
+	}
+	var top ast.StmtList
+	for _, stmt := range a.StmtList {
+		s, ok := stmt.(*ast.SubGraph)
+		if !ok || c.parents[s.Id.String()] == "Vault" || c.parents[s.Id.String()] == "" {
+			top = append(top, stmt)
+		}
+	}
+	for _, name := range c.order {
+		parent := c.parents[name]
+		if parent == "Vault" {
+			continue
+		}
+		p, ok := subs[parent]
+		if !ok {
+			return fmt.Errorf("cluster %s belongs in missing cluster %s", name, parent)
+		}
+		p.StmtList = append(p.StmtList, subs[name])
+	}
+	a.StmtList = top
+	return nil
+}
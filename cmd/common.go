@@ -21,16 +21,20 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	gph "github.com/awalterschulze/gographviz"
+	"github.com/hashicorp/vault/api"
 	"github.com/spf13/viper"
 	"github.com/yieldbot/sensuplugin/sensuutil"
 	"github.com/yieldbot/vaultVisualize/version"
+	"io"
 	"os"
 	pth "path"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // debugOut prints user defined and derived variable values including secrets.
@@ -99,6 +103,145 @@ func setCertMode() string {
 	return strconv.FormatBool(false)
 }
 
+// vaultClient returns a vault client configured from the commandline, viper
+// and the environment.
+func vaultClient() *api.Client {
+	// Set the baseline config for the vault client
+	cfg := api.DefaultConfig()
+
+	// configure tls for the client using viper
+	tls := &api.TLSConfig{}
+	c, err := strconv.ParseBool(setCertMode())
+	if err != nil {
+		syslogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   err,
+		}).Error(`Could not set cert verify mode`)
+		txtlogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   err,
+		}).Error(`Could not set cert verify mode`)
+		sensuutil.Exit("CONFIGERROR")
+	}
+	tls.Insecure = c
+	cfg.ConfigureTLS(tls)
+
+	// Set the vault server address using consul and viper
+	cfg.Address = buildUrl()
+
+	// --retries takes over from the client's own retries, which would
+	// otherwise multiply with it
+	if retries > 0 {
+		cfg.MaxRetries = 0
+	}
+
+	// Create a client token
+	cli, err := api.NewClient(cfg)
+	if err != nil {
+		syslogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   err,
+		}).Error(`Could not create new client`)
+		txtlogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   err,
+		}).Error(`Could not create new client`)
+		sensuutil.Exit("GENERALGOLANGERROR")
+	}
+
+	// Set the client auth token using viper
+	a := setAuth()
+	if a != "" {
+		cli.SetToken(a)
+	} else {
+		cli.SetToken(os.Getenv("VAULT_TOKEN"))
+	}
+	return cli
+}
+
+// crawlVault walks the keyspace below secret and returns its root.
+func crawlVault(cli *api.Client) *secret {
+	crawler.started = time.Now()
+	s, e := listKeys(cli, "secret")
+	if e == nil && s == nil {
+		e = fmt.Errorf("no keys found")
+	}
+	if e != nil {
+		syslogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   e,
+		}).Error(`Could not list vault keys, check the path`)
+		txtlogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   e,
+		}).Error(`Could not list vault keys, check the path`)
+		sensuutil.Exit("GENERALGOLANGERROR")
+	}
+	crawler.client = cli
+	root := &secret{
+		path:     "secret",
+		parent:   nil,
+		children: nil,
+		folder:   true,
+	}
+	root.engine, root.engineVersion = mountEngine(cli, root.path)
+	secrets["secret"] = root
+	keys := s.Data["keys"]
+	for _, key := range keys.([]interface{}) {
+		crawl(root, key.(string))
+	}
+	crawler.duration = time.Since(crawler.started)
+	return root
+}
+
+// loadTree returns the keyspace, read from --snapshot when it is set and
+// crawled from vault otherwise, with the policy overlay and effective
+// capabilities when requested.
+func loadTree() *secret {
+	root := readTree()
+	if policyOverlay {
+		crawler.policies = loadPolicies()
+		overlayPolicies(root, crawler.policies)
+	}
+	if asToken != "" || asAccessor != "" {
+		loadEffective(root)
+	}
+	return root
+}
+
+// readTree returns the keyspace, read from --snapshot when it is set and
+// crawled from vault otherwise.
+func readTree() *secret {
+	if snapshot == "" {
+		root := crawlVault(vaultClient())
+		crawlTelemetry()
+		return root
+	}
+	root, err := loadSnapshot(snapshot)
+	if err != nil {
+		syslogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"file":    snapshot,
+			"error":   err,
+		}).Error(`Could not read the snapshot`)
+		txtlogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"file":    snapshot,
+			"error":   err,
+		}).Error(`Could not read the snapshot`)
+		sensuutil.Exit("GENERALGOLANGERROR")
+	}
+	return root
+}
+
 // crawl will iterate over the vault keyspace starting at the root.
 func crawl(root *secret, path string) {
 	//fmt.Printf("root is %s\n", root.path) ADD TO DEBUG
@@ -108,31 +251,52 @@ func crawl(root *secret, path string) {
 			path:     pth.Join(root.path, path),
 			parent:   root,
 			children: nil,
+			folder:   strings.HasSuffix(path, "/"),
 		}
 	} else {
 		s = secret{
-			path:     path,
+			path:     strings.TrimSuffix(path, "/"),
 			parent:   root,
 			children: nil,
+			folder:   strings.HasSuffix(path, "/"),
 		}
 	}
 	//fmt.Printf("crawling %s\n", s.path) ADD TO DEBUG
 	crawler.Lock()
 	secrets[s.path] = &s
 	root.addChild(&s)
-	sec, _ := crawler.client.Logical().List(s.path)
-	keys := sec.Data["keys"]
+	if !s.folder {
+		crawler.Unlock()
+		return
+	}
+	sec, err := listKeys(crawler.client, s.path)
+	if err != nil {
+		crawler.errors = append(crawler.errors, crawlError{s.path, err.Error()})
+	}
 	//spew.Dump(sec) ADD TO DEBUG
 	crawler.Unlock()
+	if sec == nil {
+		return
+	}
+	keys := sec.Data["keys"]
 	if keys == nil {
 		return
 	}
 	if len(keys.([]interface{})) == 0 {
-		fmt.Println("No additional keys")
+		syslogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"path":    s.path,
+		}).Info(`No additional keys`)
+		txtlogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"path":    s.path,
+		}).Info(`No additional keys`)
 		return
 	}
 	for _, key := range keys.([]interface{}) {
-		crawl(&s, fmt.Sprintf("%s/%s", s.path, strings.Trim(key.(string), "/")))
+		crawl(&s, fmt.Sprintf("%s/%s", s.path, strings.TrimLeft(key.(string), "/")))
 	}
 	return
 }
@@ -142,17 +306,191 @@ func (s *secret) addChild(child *secret) {
 	s.children = append(s.children, child)
 }
 
-// outputSTD prints a human readable to stdout
-func outputSTD(node *secret) {
+// name returns the label of the secret, which is the last element of the
+// secret path unless it was replaced when simplifying the graph.
+func (s *secret) name() string {
+	if s.label != "" {
+		return s.label
+	}
+	return pth.Base(s.path)
+}
+
+// depth returns how many levels below the root of the crawl the secret sits.
+func (s *secret) depth() int {
+	d := 0
+	for p := s.parent; p != nil; p = p.parent {
+		d++
+	}
+	return d
+}
+
+// link returns the url the node links to when drawn, if any.
+func (s *secret) link() string {
+	return s.annotations["url"]
+}
+
+// nodeType returns "mount" for the root of the crawl, "folder" for keys that
+// hold other keys, "summary" for nodes standing in for the children of an
+// oversized folder and "secret" for everything else.
+func (s *secret) nodeType() string {
+	switch {
+	case s.parent == nil:
+		return "mount"
+	case s.summary > 0:
+		return "summary"
+	case s.folder:
+		return "folder"
+	}
+	return "secret"
+}
+
+// mountNode returns the root of the crawl the secret belongs to.
+func (s *secret) mountNode() *secret {
+	m := s
+	for m.parent != nil {
+		m = m.parent
+	}
+	return m
+}
+
+// mount returns the path of the mount the secret was crawled from.
+func (s *secret) mount() string {
+	return s.mountNode().path
+}
+
+// mountEngine returns the secrets engine type and version of the mount at
+// path. Not every token may read sys/mounts, so any failure leaves both empty.
+func mountEngine(cli *api.Client, path string) (string, string) {
+	resp, err := vaultRequest(cli, "READ", "sys/mounts")
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil || resp.StatusCode != 200 {
+		return "", ""
+	}
+
+	var result map[string]interface{}
+	if err := resp.DecodeJSON(&result); err != nil {
+		return "", ""
+	}
+	// Newer servers wrap the mounts in a data object.
+	if data, ok := result["data"].(map[string]interface{}); ok {
+		result = data
+	}
+	m, ok := result[strings.TrimSuffix(path, "/")+"/"].(map[string]interface{})
+	if !ok {
+		return "", ""
+	}
+	engine, _ := m["type"].(string)
+	version := ""
+	if opts, ok := m["options"].(map[string]interface{}); ok {
+		version, _ = opts["version"].(string)
+	}
+	if engine == "kv" && version == "" {
+		version = "1"
+	}
+	return engine, version
+}
+
+// leafCount returns the number of secrets below the node, or 1 when the node
+// is itself a secret.
+func (s *secret) leafCount() int {
+	if s.summary > 0 {
+		return s.summary
+	}
+	if len(s.children) == 0 && s.nodeType() == "secret" {
+		return 1
+	}
+	n := 0
+	for _, child := range s.children {
+		n += child.leafCount()
+	}
+	return n
+}
+
+// view holds the options deciding which nodes of the keyspace are rendered:
+// --depth, --filter and --capability.
+type view struct {
+	depth      int    // deepest level below the root, 0 for all of them
+	filter     string // path glob, empty for every path
+	capability string // capability the effective annotation must include
+}
+
+// flagView returns the view selected on the command line.
+func flagView() view {
+	return view{depth: maxDepth, filter: filter, capability: capFilter}
+}
+
+// filterMatch reports whether the secret, one of its parents or one of its
+// children matches the filter glob. Parents are kept so a match can still be
+// drawn from the root, children so a matching folder is drawn in full.
+func filterMatch(s *secret, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	for p := s; p != nil; p = p.parent {
+		if ok, _ := pth.Match(filter, p.path); ok {
+			return true
+		}
+	}
+	return descendantMatch(s, filter)
+}
+
+// descendantMatch reports whether any child below the secret matches the
+// filter glob.
+func descendantMatch(s *secret, filter string) bool {
+	for _, child := range s.children {
+		if ok, _ := pth.Match(filter, child.path); ok || descendantMatch(child, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// visible reports whether the secret should be rendered in the view.
+func (v view) visible(s *secret) bool {
+	if v.depth > 0 && s.depth() > v.depth {
+		return false
+	}
+	return filterMatch(s, v.filter) && capabilityMatch(s, v.capability)
+}
+
+// children returns the children of the secret that should be rendered.
+func (v view) children(s *secret) []*secret {
+	var out []*secret
+	for _, child := range s.children {
+		if v.visible(child) {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// pathsOut writes the path of every secret below node, one per line.
+func pathsOut(w io.Writer, node *secret) error {
 	for _, child := range node.children {
-		fmt.Println(child.path)
-		outputSTD(child)
+		if _, err := io.WriteString(w, child.path+"\n"); err != nil {
+			return err
+		}
+		if err := pathsOut(w, child); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// output to a file
+// outputFile writes every path below node to outFile. The file is replaced
+// atomically unless --append is set.
 func outputFile(node *secret, outFile string) {
-	f, err := os.OpenFile(outFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	var b bytes.Buffer
+	pathsOut(&b, node)
+
+	var err error
+	if appendOut {
+		err = appendFile(outFile, b.Bytes())
+	} else {
+		err = writeAtomic(outFile, b.Bytes())
+	}
 	if err != nil {
 		syslogLog.WithFields(logrus.Fields{
 			"host":    host,
@@ -160,7 +498,7 @@ func outputFile(node *secret, outFile string) {
 			"version": version.AppVersion(),
 			"file":    outFile,
 			"error":   err,
-		}).Error(`Could not create or open the specified output file`)
+		}).Error(`Could not write to the specified output file`)
 
 		txtlogLog.WithFields(logrus.Fields{
 			"host":    host,
@@ -168,72 +506,38 @@ func outputFile(node *secret, outFile string) {
 			"version": version.AppVersion(),
 			"file":    outFile,
 			"error":   err,
-		}).Error(`Could not create or open the specified output file`)
+		}).Error(`Could not write to the specified output file`)
 		sensuutil.Exit("GENERALGOLANGERROR")
 	}
-
-	defer f.Close()
-
-	for _, child := range node.children {
-		if _, err = f.WriteString(child.path + "\n"); err != nil {
-			syslogLog.WithFields(logrus.Fields{
-				"host":    host,
-				"app":     "vaultVisualize",
-				"version": version.AppVersion(),
-				"file":    outFile,
-				"error":   err,
-			}).Error(`Could not write to the specified output file`)
-
-			txtlogLog.WithFields(logrus.Fields{
-				"host":    host,
-				"app":     "vaultVisualize",
-				"version": version.AppVersion(),
-				"file":    outFile,
-				"error":   err,
-			}).Error(`Could not write to the specified output file`)
-			sensuutil.Exit("GENERALGOLANGERROR")
-		}
-
-		outputFile(child, outFile)
-	}
-
 }
 
 func stringParse(s string) string {
 	return strings.Replace(s, "-", "_", -1)
 }
 
+// colorPick returns the quoted colour at index i of colorMap, wrapping around
+// when i is past the end of the palette.
 func colorPick(i int) string {
+	return colorMap[i%len(colorMap)]
+}
 
-	colorMap[0] = "\"red\""
-	colorMap[1] = "\"blue\""
-	colorMap[2] = "\"green\""
-	colorMap[3] = "\"yellow\""
-	colorMap[4] = "\"orange\""
-	colorMap[5] = "\"purple\""
-	colorMap[6] = "\"brown\""
-
-	return colorMap[i]
-}
-
-func graphOut(g *gph.Graph, node *secret, rPath string, ct int) {
-	pSplit := strings.Split(node.path, "/")
-	lastEl := pSplit[len(pSplit)-1]
-	lastEl = stringParse(lastEl)
-	//params["color"] = colorPick(ct)
-	params["style"] = "\"bold\""
-	//
-	//fmt.Println("Color:" + colorPick(ct))
-	//fmt.Println("Node:" + lastEl)
-	//fmt.Println(params)
-
-	g.AddNode("Vault", rPath, params)
-	g.AddNode("Vault", lastEl, params)
-	g.AddEdge(rPath, lastEl, true, nil)
-	rPath = lastEl
-	for _, child := range node.children {
-		ct = ct + 1
-		graphOut(g, child, rPath, ct)
+// dotAttrs returns the quoted attributes used to draw the node in dot.
+func dotAttrs(t *theme, node *secret) map[string]string {
+	attrs := t.attrs(node)
+	attrs["label"] = dotQuote(node.name())
+	if l := node.link(); l != "" {
+		attrs["URL"] = dotQuote(l)
 	}
+	return attrs
+}
 
+// graphOut adds the node and everything visible below it to the subgraph sub,
+// styled by the theme, with an edge from the parent node rPath.
+func graphOut(g *gph.Graph, t *theme, v view, node *secret, rPath string, sub string) {
+	id := dotQuote(node.path)
+	g.AddNode(sub, id, dotAttrs(t, node))
+	g.AddEdge(rPath, id, true, t.edgeAttrs(node))
+	for _, child := range v.children(node) {
+		graphOut(g, t, v, child, id, sub)
+	}
 }
@@ -23,21 +23,49 @@ package cmd
 import (
 	"github.com/hashicorp/vault/api"
 	"sync"
+	"time"
 )
 
 var crawler struct {
-	client *api.Client
+	client   *api.Client
+	errors   []crawlError // failed requests, reported instead of stopping the crawl
+	requests int          // LIST requests sent
+	started  time.Time
+	duration time.Duration
+	timings  []requestTiming // every request sent, in order
+	policies []*aclPolicy    // read with --policies or from the snapshot
 	sync.Mutex
 }
 
+// crawlError records a path that could not be listed during the crawl.
+type crawlError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
 var secrets = map[string]*secret{}
 
 type secret struct {
-	path     string
-	parent   *secret
-	children []*secret
-}
+	path        string
+	parent      *secret
+	children    []*secret
+	folder      bool              // the key was listed with a trailing slash
+	annotations map[string]string // data attached after the crawl, carried into the exports
+	label       string            // replaces the last path element when drawn, set on simplified copies
+	summary     int               // number of secrets a summary node stands in for
 
-var params map[string]string = make(map[string]string)
+	// Only set on the mount at the root of the crawl.
+	engine        string // secrets engine type, e.g. kv
+	engineVersion string // secrets engine version from the mount options
+}
 
-var colorMap = map[int]string{}
+// colorMap is the palette used by themes that colour nodes automatically.
+var colorMap = map[int]string{
+	0: "\"red\"",
+	1: "\"blue\"",
+	2: "\"green\"",
+	3: "\"yellow\"",
+	4: "\"orange\"",
+	5: "\"purple\"",
+	6: "\"brown\"",
+}
@@ -0,0 +1,164 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// nodeIDs hands out short identifiers that are valid in every diagram syntax.
+// They are keyed by the full secret path so that keys with the same name in
+// different folders stay separate nodes.
+type nodeIDs map[string]string
+
+// get returns the identifier for the path, allocating one on first use.
+func (ids nodeIDs) get(path string) string {
+	if id, ok := ids[path]; ok {
+		return id
+	}
+	id := "n" + strconv.Itoa(len(ids))
+	ids[path] = id
+	return id
+}
+
+// mermaidEscape makes a label safe to use inside a quoted mermaid node.
+func mermaidEscape(s string) string {
+	return strings.Replace(s, "\"", "#quot;", -1)
+}
+
+// plantumlEscape makes a label safe from creole markup by prefixing every
+// markup character with the creole escape character.
+func plantumlEscape(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		if strings.ContainsRune("~*_-/\"<>[]#", r) {
+			b.WriteRune('~')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// d2Escape makes a label safe to use inside a double quoted d2 string.
+func d2Escape(s string) string {
+	return strings.Replace(strings.Replace(s, "\\", "\\\\", -1), "\"", "\\\"", -1)
+}
+
+// mermaidOut writes the keyspace as a top down mermaid flowchart.
+func mermaidOut(w io.Writer, root *secret, v view) error {
+	ids := nodeIDs{}
+	var b bytes.Buffer
+	b.WriteString("graph TD\n")
+	var walk func(node *secret)
+	walk = func(node *secret) {
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids.get(node.path), mermaidEscape(node.name()))
+		if l := node.link(); l != "" {
+			fmt.Fprintf(&b, "    click %s href \"%s\"\n", ids.get(node.path), mermaidEscape(l))
+		}
+		for _, child := range v.children(node) {
+			fmt.Fprintf(&b, "    %s --> %s\n", ids.get(node.path), ids.get(child.path))
+			walk(child)
+		}
+	}
+	walk(root)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidMindmapOut writes the keyspace as a mermaid mindmap, using
+// indentation rather than edges to show the hierarchy.
+func mermaidMindmapOut(w io.Writer, root *secret, v view) error {
+	ids := nodeIDs{}
+	var b bytes.Buffer
+	b.WriteString("mindmap\n")
+	var walk func(node *secret, indent int)
+	walk = func(node *secret, indent int) {
+		l, r := "[\"", "\"]"
+		if node == root {
+			l, r = "((\"", "\"))"
+		}
+		fmt.Fprintf(&b, "%s%s%s%s%s\n", strings.Repeat("  ", indent), ids.get(node.path), l, mermaidEscape(node.name()), r)
+		for _, child := range v.children(node) {
+			walk(child, indent+1)
+		}
+	}
+	walk(root, 1)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// plantumlTree writes the keyspace in the star prefixed outline shared by the
+// plantuml wbs and mindmap diagrams.
+func plantumlTree(w io.Writer, root *secret, v view, kind string) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "@start%s\n", kind)
+	var walk func(node *secret, level int)
+	walk = func(node *secret, level int) {
+		label := plantumlEscape(node.name())
+		if l := node.link(); l != "" {
+			label = "[[" + l + " " + label + "]]"
+		}
+		fmt.Fprintf(&b, "%s %s\n", strings.Repeat("*", level), label)
+		for _, child := range v.children(node) {
+			walk(child, level+1)
+		}
+	}
+	walk(root, 1)
+	fmt.Fprintf(&b, "@end%s\n", kind)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// plantumlOut writes the keyspace as a plantuml work breakdown structure.
+func plantumlOut(w io.Writer, root *secret, v view) error {
+	return plantumlTree(w, root, v, "wbs")
+}
+
+// plantumlMindmapOut writes the keyspace as a plantuml mindmap.
+func plantumlMindmapOut(w io.Writer, root *secret, v view) error {
+	return plantumlTree(w, root, v, "mindmap")
+}
+
+// d2Out writes the keyspace as a d2 diagram.
+func d2Out(w io.Writer, root *secret, v view) error {
+	ids := nodeIDs{}
+	var b bytes.Buffer
+	b.WriteString("direction: down\n")
+	var walk func(node *secret)
+	walk = func(node *secret) {
+		fmt.Fprintf(&b, "%s: \"%s\"", ids.get(node.path), d2Escape(node.name()))
+		if l := node.link(); l != "" {
+			fmt.Fprintf(&b, " {link: \"%s\"}", d2Escape(l))
+		}
+		b.WriteString("\n")
+		for _, child := range v.children(node) {
+			fmt.Fprintf(&b, "%s -> %s\n", ids.get(node.path), ids.get(child.path))
+			walk(child)
+		}
+	}
+	walk(root)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,126 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	pth "path"
+	"strings"
+	"testing"
+)
+
+// testTree builds a small keyspace rooted at secret for the output tests.
+func testTree() *secret {
+	return buildTree("secret/app-1/", "secret/app-1/db", "secret/app-1/api", "secret/ops/", "secret/ops/db")
+}
+
+// buildTree builds a keyspace rooted at secret from a list of paths, parents
+// first. Paths ending in a slash are folders.
+func buildTree(paths ...string) *secret {
+	root := &secret{path: "secret", folder: true}
+	nodes := map[string]*secret{"secret": root}
+	for _, p := range paths {
+		key := strings.TrimSuffix(p, "/")
+		parent := nodes[pth.Dir(key)]
+		s := &secret{path: key, parent: parent, folder: strings.HasSuffix(p, "/")}
+		parent.addChild(s)
+		nodes[key] = s
+	}
+	return root
+}
+
+func TestMermaidOut(t *testing.T) {
+
+	Convey("When rendering the test tree as a mermaid flowchart", t, func() {
+		var b bytes.Buffer
+		err := mermaidOut(&b, testTree(), view{})
+
+		Convey("No error should be returned", func() {
+			So(err, should.BeNil)
+		})
+		Convey("The output should start with a top down graph declaration", func() {
+			So(b.String(), should.StartWith, "graph TD\n")
+		})
+		Convey("Keys with the same name in different folders should be separate nodes", func() {
+			So(b.String(), should.ContainSubstring, "n2[\"db\"]")
+			So(b.String(), should.ContainSubstring, "n5[\"db\"]")
+		})
+		Convey("The edges should follow the folder structure", func() {
+			So(b.String(), should.ContainSubstring, "n0 --> n1\n")
+			So(b.String(), should.ContainSubstring, "n4 --> n5\n")
+		})
+	})
+
+	Convey("When rendering the test tree with --depth 1", t, func() {
+		var b bytes.Buffer
+		mermaidOut(&b, testTree(), view{depth: 1})
+
+		Convey("Only the first level folders should be drawn", func() {
+			So(b.String(), should.ContainSubstring, "[\"app-1\"]")
+			So(b.String(), should.NotContainSubstring, "[\"db\"]")
+		})
+	})
+
+	Convey("When rendering the test tree with --filter secret/ops", t, func() {
+		var b bytes.Buffer
+		mermaidOut(&b, testTree(), view{filter: "secret/ops"})
+
+		Convey("The matching folder and its children should be drawn", func() {
+			So(b.String(), should.ContainSubstring, "[\"ops\"]")
+			So(b.String(), should.ContainSubstring, "[\"db\"]")
+		})
+		Convey("Folders that do not match should not be drawn", func() {
+			So(b.String(), should.NotContainSubstring, "app-1")
+		})
+	})
+}
+
+func TestPlantumlOut(t *testing.T) {
+
+	Convey("When rendering the test tree as a plantuml wbs", t, func() {
+		var b bytes.Buffer
+		plantumlOut(&b, testTree(), view{})
+
+		Convey("The diagram should be wrapped in wbs markers", func() {
+			So(b.String(), should.StartWith, "@startwbs\n")
+			So(b.String(), should.EndWith, "@endwbs\n")
+		})
+		Convey("The depth should be shown by the number of stars", func() {
+			So(b.String(), should.ContainSubstring, "\n*** db\n")
+		})
+		Convey("Creole markup characters should be escaped", func() {
+			So(b.String(), should.ContainSubstring, "** app~-1\n")
+		})
+	})
+}
+
+func TestD2Escape(t *testing.T) {
+
+	Convey("When the label contains quotes and backslashes", t, func() {
+		out := d2Escape(`a"b\c`)
+
+		Convey("Both should be escaped with a backslash", func() {
+			So(out, should.Equal, `a\"b\\c`)
+		})
+	})
+}
@@ -0,0 +1,256 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"strings"
+)
+
+var asToken string    // Token whose effective capabilities are shown
+var asAccessor string // Accessor of the token whose effective capabilities are shown
+var capFilter string  // Only render paths where the effective capabilities include this one
+
+// accessIndex is the palette index used for each access level by
+// color_by: access.
+var accessIndex = map[string]int{"write": 0, "list": 2, "read": 4, "sudo": 5, "deny": 6}
+
+// capabilityChecker asks vault for the capabilities a token has, one request
+// per folder covering all of its children.
+type capabilityChecker struct {
+	cli      *api.Client
+	token    string
+	accessor string
+	cache    map[string]map[string][]string // folder path to the capabilities of each acl path in it
+}
+
+// newCapabilityChecker returns a checker for the token, or for the token
+// behind the accessor when token is empty.
+func newCapabilityChecker(cli *api.Client, token, accessor string) *capabilityChecker {
+	return &capabilityChecker{cli: cli, token: token, accessor: accessor, cache: map[string]map[string][]string{}}
+}
+
+// request looks up the capabilities on every path in a single request. Vault
+// only answers per path when it supports the paths list; older servers are
+// asked again one path at a time.
+func (c *capabilityChecker) request(paths []string) (map[string][]string, error) {
+	body := map[string]interface{}{"paths": paths, "path": paths[0]}
+	endpoint := "/v1/sys/capabilities"
+	switch {
+	case c.accessor != "":
+		endpoint += "-accessor"
+		body["accessor"] = c.accessor
+	case c.token == c.cli.Token():
+		endpoint += "-self"
+	default:
+		body["token"] = c.token
+	}
+	r := c.cli.NewRequest("POST", endpoint)
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+	resp, err := c.cli.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not look up the capabilities on %s: %s", paths[0], err)
+	}
+	var result map[string]interface{}
+	if err := resp.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	if data, ok := result["data"].(map[string]interface{}); ok {
+		result = data
+	}
+
+	out := map[string][]string{}
+	for _, p := range paths {
+		raw, ok := result[p].([]interface{})
+		if !ok && len(paths) == 1 {
+			raw, ok = result["capabilities"].([]interface{})
+		}
+		if !ok && len(paths) > 1 {
+			return c.oneByOne(paths)
+		}
+		if !ok {
+			return nil, fmt.Errorf("could not look up the capabilities on %s: vault did not return any", p)
+		}
+		var caps []string
+		for _, v := range raw {
+			if s, ok := v.(string); ok {
+				caps = append(caps, s)
+			}
+		}
+		out[p] = tokenCapabilities(caps)
+	}
+	return out, nil
+}
+
+// oneByOne looks up the capabilities on each path with its own request.
+func (c *capabilityChecker) oneByOne(paths []string) (map[string][]string, error) {
+	out := map[string][]string{}
+	for _, p := range paths {
+		caps, err := c.request([]string{p})
+		if err != nil {
+			return nil, err
+		}
+		out[p] = caps[p]
+	}
+	return out, nil
+}
+
+// folder returns the capabilities on the acl path of every child of the
+// folder, and of the folder itself when it is the root.
+func (c *capabilityChecker) folder(node *secret) (map[string][]string, error) {
+	if caps, ok := c.cache[node.path]; ok {
+		return caps, nil
+	}
+	var paths []string
+	if node.parent == nil {
+		paths = append(paths, node.aclPath())
+	}
+	for _, child := range node.children {
+		paths = append(paths, child.aclPath())
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	caps, err := c.request(paths)
+	if err != nil {
+		return nil, err
+	}
+	c.cache[node.path] = caps
+	return caps, nil
+}
+
+// tokenCapabilities sorts the capabilities returned by vault, expanding the
+// root capability of root tokens.
+func tokenCapabilities(caps []string) []string {
+	for _, c := range caps {
+		if c == "root" {
+			return sortCapabilities(legacyCapabilities["sudo"])
+		}
+	}
+	if len(caps) == 0 {
+		return []string{"deny"}
+	}
+	return sortCapabilities(caps)
+}
+
+// overlayEffective annotates every node below root with the capabilities
+// the checked token has on it.
+func overlayEffective(root *secret, c *capabilityChecker) error {
+	caps, err := c.folder(root)
+	if err != nil {
+		return err
+	}
+	annotate := func(node *secret) {
+		if node.annotations == nil {
+			node.annotations = map[string]string{}
+		}
+		node.annotations["effective"] = strings.Join(caps[node.aclPath()], ",")
+	}
+	if root.parent == nil {
+		annotate(root)
+	}
+	for _, child := range root.children {
+		annotate(child)
+		if child.nodeType() != "secret" {
+			if err := overlayEffective(child, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// accessLevel sums up the effective capabilities of a node as the most
+// powerful thing they allow: sudo, write, read, list or deny. It is empty
+// when the capabilities were not looked up.
+func accessLevel(node *secret) string {
+	caps, ok := node.annotations["effective"]
+	if !ok {
+		return ""
+	}
+	has := map[string]bool{}
+	for _, c := range strings.Split(caps, ",") {
+		has[c] = true
+	}
+	switch {
+	case has["sudo"]:
+		return "sudo"
+	case has["create"] || has["update"] || has["delete"]:
+		return "write"
+	case has["read"]:
+		return "read"
+	case has["list"]:
+		return "list"
+	}
+	return "deny"
+}
+
+// capabilityMatch reports whether the effective capabilities of the secret or
+// of one of its children include capability.
+func capabilityMatch(s *secret, capability string) bool {
+	if capability == "" {
+		return true
+	}
+	for _, c := range strings.Split(s.annotations["effective"], ",") {
+		if c == capability {
+			return true
+		}
+	}
+	for _, child := range s.children {
+		if capabilityMatch(child, capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadEffective annotates the keyspace with the capabilities of the token
+// given by --as-token or --as-accessor, exiting when they can not be read.
+func loadEffective(root *secret) {
+	var err error
+	if asToken != "" && asAccessor != "" {
+		err = fmt.Errorf("only one of --as-token and --as-accessor can be given")
+	} else {
+		err = overlayEffective(root, newCapabilityChecker(vaultClient(), asToken, asAccessor))
+	}
+	if err != nil {
+		syslogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   err,
+		}).Error(`Could not read the effective capabilities`)
+		txtlogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   err,
+		}).Error(`Could not read the effective capabilities`)
+		sensuutil.Exit("GENERALGOLANGERROR")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/hashicorp/vault/api"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// capabilityServer answers capability lookups with read on secret/app and
+// below, list on folders and nothing elsewhere. With batch unset it only
+// understands a single path, like older vault servers.
+func capabilityServer(batch bool, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		var body struct {
+			Path  string   `json:"path"`
+			Paths []string `json:"paths"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		caps := func(p string) []string {
+			switch {
+			case p == "secret/app/db":
+				return []string{"read"}
+			case p[len(p)-1] == '/':
+				return []string{"list"}
+			}
+			return []string{"deny"}
+		}
+		out := map[string]interface{}{"capabilities": caps(body.Path)}
+		if batch {
+			for _, p := range body.Paths {
+				out[p] = caps(p)
+			}
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+}
+
+func TestOverlayEffective(t *testing.T) {
+
+	for _, batch := range []bool{true, false} {
+		Convey("When looking up the capabilities of a token", t, func() {
+			requests := 0
+			ts := capabilityServer(batch, &requests)
+			defer ts.Close()
+			cfg := api.DefaultConfig()
+			cfg.Address = ts.URL
+			cli, _ := api.NewClient(cfg)
+			root := buildTree("secret/app/", "secret/app/db", "secret/app/api", "secret/top")
+			c := newCapabilityChecker(cli, "other-token", "")
+			So(overlayEffective(root, c), should.BeNil)
+
+			Convey("Every node should be annotated", func() {
+				So(root.annotations["effective"], should.Equal, "list")
+				So(secretAt(root, "secret/app/db").annotations["effective"], should.Equal, "read")
+				So(secretAt(root, "secret/top").annotations["effective"], should.Equal, "deny")
+			})
+			Convey("Each folder should be looked up once", func() {
+				if batch {
+					So(requests, should.Equal, 2)
+				}
+				So(c.cache, should.ContainKey, "secret/app")
+				So(overlayEffective(root, c), should.BeNil)
+				So(c.cache, should.HaveLength, 2)
+			})
+		})
+	}
+
+	Convey("A response without any capabilities should be an error", t, func() {
+		requests := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte("{}"))
+		}))
+		defer ts.Close()
+		cfg := api.DefaultConfig()
+		cfg.Address = ts.URL
+		cli, _ := api.NewClient(cfg)
+		_, err := newCapabilityChecker(cli, "other-token", "").request([]string{"secret/a", "secret/b"})
+		So(err, should.NotBeNil)
+		So(requests, should.Equal, 2)
+	})
+
+	Convey("Root tokens should have every capability", t, func() {
+		So(tokenCapabilities([]string{"root"}), should.Resemble, []string{"create", "read", "update", "delete", "list", "sudo"})
+		So(tokenCapabilities(nil), should.Resemble, []string{"deny"})
+	})
+}
+
+func TestAccessFilter(t *testing.T) {
+
+	Convey("When filtering by effective capability", t, func() {
+		root := buildTree("secret/app/", "secret/app/db", "secret/app/api", "secret/top")
+		for path, caps := range map[string]string{"secret": "list", "secret/app": "list", "secret/app/db": "read,update", "secret/app/api": "deny", "secret/top": "deny"} {
+			n := secretAt(root, path)
+			n.annotations = map[string]string{"effective": caps}
+		}
+
+		Convey("Only matching paths and their parents should be visible", func() {
+			var paths []string
+			for _, n := range (view{capability: "read"}).nodes(root) {
+				paths = append(paths, n.path)
+			}
+			So(paths, should.Resemble, []string{"secret", "secret/app", "secret/app/db"})
+		})
+		Convey("Nodes should be summed up by their strongest capability", func() {
+			So(accessLevel(secretAt(root, "secret/app/db")), should.Equal, "write")
+			So(accessLevel(secretAt(root, "secret/app")), should.Equal, "list")
+			So(accessLevel(secretAt(root, "secret/top")), should.Equal, "deny")
+		})
+	})
+}
@@ -0,0 +1,194 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// column is a typed node attribute written by the graph interchange formats
+// so that tools like gephi and cytoscape can filter and colour on it.
+type column struct {
+	name  string
+	kind  string // "string" or "int"
+	value func(s *secret) string
+}
+
+// baseColumns are the attributes every node carries.
+var baseColumns = []column{
+	{"type", "string", func(s *secret) string { return s.nodeType() }},
+	{"mount", "string", func(s *secret) string { return s.mount() }},
+	{"depth", "int", func(s *secret) string { return strconv.Itoa(s.depth()) }},
+	{"leaves", "int", func(s *secret) string { return strconv.Itoa(s.leafCount()) }},
+}
+
+// nodes returns the root and every node below it that should be
+// rendered, parents before their children.
+func (v view) nodes(root *secret) []*secret {
+	nodes := []*secret{root}
+	for _, child := range v.children(root) {
+		nodes = append(nodes, v.nodes(child)...)
+	}
+	return nodes
+}
+
+// annotationNames returns the sorted names of every annotation on the nodes.
+func annotationNames(nodes []*secret) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, node := range nodes {
+		for k := range node.annotations {
+			if !seen[k] {
+				seen[k] = true
+				names = append(names, k)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nodeColumns returns the base columns followed by one string column for
+// every annotation found on the nodes, sorted by name.
+func nodeColumns(nodes []*secret) []column {
+	cols := append([]column{}, baseColumns...)
+	for _, n := range annotationNames(nodes) {
+		name := n
+		cols = append(cols, column{name, "string", func(s *secret) string { return s.annotations[name] }})
+	}
+	return cols
+}
+
+// xmlEscape returns s escaped for use in xml text and attribute values.
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// graphmlOut writes the keyspace as graphml for yEd and gephi.
+func graphmlOut(w io.Writer, root *secret, v view) error {
+	nodes := v.nodes(root)
+	cols := nodeColumns(nodes)
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	b.WriteString("  <key id=\"label\" for=\"node\" attr.name=\"label\" attr.type=\"string\"/>\n")
+	for i, c := range cols {
+		fmt.Fprintf(&b, "  <key id=\"d%d\" for=\"node\" attr.name=\"%s\" attr.type=\"%s\"/>\n", i, xmlEscape(c.name), c.kind)
+	}
+	b.WriteString("  <graph id=\"Vault\" edgedefault=\"directed\">\n")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", xmlEscape(node.path))
+		fmt.Fprintf(&b, "      <data key=\"label\">%s</data>\n", xmlEscape(node.name()))
+		for i, c := range cols {
+			fmt.Fprintf(&b, "      <data key=\"d%d\">%s</data>\n", i, xmlEscape(c.value(node)))
+		}
+		b.WriteString("    </node>\n")
+	}
+	for _, node := range nodes[1:] {
+		fmt.Fprintf(&b, "    <edge source=\"%s\" target=\"%s\"/>\n", xmlEscape(node.parent.path), xmlEscape(node.path))
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// gexfOut writes the keyspace as gexf 1.2 for gephi.
+func gexfOut(w io.Writer, root *secret, v view) error {
+	nodes := v.nodes(root)
+	cols := nodeColumns(nodes)
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString("<gexf xmlns=\"http://www.gexf.net/1.2draft\" version=\"1.2\">\n")
+	b.WriteString("  <graph mode=\"static\" defaultedgetype=\"directed\">\n")
+	b.WriteString("    <attributes class=\"node\">\n")
+	for i, c := range cols {
+		kind := c.kind
+		if kind == "int" {
+			kind = "integer"
+		}
+		fmt.Fprintf(&b, "      <attribute id=\"%d\" title=\"%s\" type=\"%s\"/>\n", i, xmlEscape(c.name), kind)
+	}
+	b.WriteString("    </attributes>\n    <nodes>\n")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "      <node id=\"%s\" label=\"%s\">\n        <attvalues>\n", xmlEscape(node.path), xmlEscape(node.name()))
+		for i, c := range cols {
+			fmt.Fprintf(&b, "          <attvalue for=\"%d\" value=\"%s\"/>\n", i, xmlEscape(c.value(node)))
+		}
+		b.WriteString("        </attvalues>\n      </node>\n")
+	}
+	b.WriteString("    </nodes>\n    <edges>\n")
+	for i, node := range nodes[1:] {
+		fmt.Fprintf(&b, "      <edge id=\"%d\" source=\"%s\" target=\"%s\"/>\n", i, xmlEscape(node.parent.path), xmlEscape(node.path))
+	}
+	b.WriteString("    </edges>\n  </graph>\n</gexf>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// cytoscapeOut writes the keyspace as cytoscape.js elements json, which the
+// cytoscape desktop app can also import.
+func cytoscapeOut(w io.Writer, root *secret, v view) error {
+	nodes := v.nodes(root)
+	cols := nodeColumns(nodes)
+	elNodes, elEdges := []map[string]interface{}{}, []map[string]interface{}{}
+	for _, node := range nodes {
+		data := map[string]interface{}{
+			"id":    node.path,
+			"label": node.name(),
+		}
+		for _, c := range cols {
+			v := c.value(node)
+			if c.kind == "int" {
+				n, _ := strconv.Atoi(v)
+				data[c.name] = n
+			} else {
+				data[c.name] = v
+			}
+		}
+		elNodes = append(elNodes, map[string]interface{}{"data": data})
+		if node != root {
+			elEdges = append(elEdges, map[string]interface{}{"data": map[string]interface{}{
+				"id":     node.parent.path + "->" + node.path,
+				"source": node.parent.path,
+				"target": node.path,
+			}})
+		}
+	}
+	out, err := json.MarshalIndent(map[string]interface{}{
+		"elements": map[string]interface{}{
+			"nodes": elNodes,
+			"edges": elEdges,
+		},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
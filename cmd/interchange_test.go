@@ -0,0 +1,95 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNodeColumns(t *testing.T) {
+
+	Convey("When a node in the tree carries annotations", t, func() {
+		root := testTree()
+		root.children[1].annotations = map[string]string{"owner": "ops"}
+		cols := nodeColumns(view{}.nodes(root))
+
+		Convey("The base columns should come first", func() {
+			So(cols[0].name, should.Equal, "type")
+			So(cols[3].name, should.Equal, "leaves")
+		})
+		Convey("Each annotation should become an extra string column", func() {
+			So(len(cols), should.Equal, len(baseColumns)+1)
+			So(cols[4].name, should.Equal, "owner")
+			So(cols[4].kind, should.Equal, "string")
+		})
+	})
+}
+
+func TestGraphmlOut(t *testing.T) {
+
+	Convey("When rendering the test tree as graphml", t, func() {
+		var b bytes.Buffer
+		graphmlOut(&b, testTree(), view{})
+
+		Convey("The typed attribute keys should be declared", func() {
+			So(b.String(), should.ContainSubstring, "attr.name=\"depth\" attr.type=\"int\"")
+		})
+		Convey("Nodes should be keyed by their full path", func() {
+			So(b.String(), should.ContainSubstring, "<node id=\"secret/ops/db\">")
+			So(b.String(), should.ContainSubstring, "<edge source=\"secret/ops\" target=\"secret/ops/db\"/>")
+		})
+	})
+}
+
+func TestCytoscapeOut(t *testing.T) {
+
+	Convey("When rendering the test tree as cytoscape json", t, func() {
+		var b bytes.Buffer
+		cytoscapeOut(&b, testTree(), view{})
+		var out struct {
+			Elements struct {
+				Nodes []struct {
+					Data map[string]interface{}
+				}
+				Edges []struct {
+					Data map[string]interface{}
+				}
+			}
+		}
+		err := json.Unmarshal(b.Bytes(), &out)
+
+		Convey("The output should be valid json", func() {
+			So(err, should.BeNil)
+		})
+		Convey("There should be a node for every key and an edge for every parent", func() {
+			So(len(out.Elements.Nodes), should.Equal, 6)
+			So(len(out.Elements.Edges), should.Equal, 5)
+		})
+		Convey("Integer columns should be written as numbers", func() {
+			So(out.Elements.Nodes[0].Data["leaves"], should.Equal, 3.0)
+			So(out.Elements.Nodes[0].Data["type"], should.Equal, "mount")
+		})
+	})
+}
@@ -0,0 +1,129 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+// jsonNode is the nested json form of a secret.
+type jsonNode struct {
+	Path          string            `json:"path"`
+	Type          string            `json:"type"`
+	Engine        string            `json:"engine,omitempty"`
+	EngineVersion string            `json:"engine_version,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+	Children      []*jsonNode       `json:"children,omitempty"`
+	Errors        []crawlError      `json:"errors,omitempty"` // the rest are only on the root
+	Requests      int               `json:"requests,omitempty"`
+	CrawlSeconds  float64           `json:"crawl_seconds,omitempty"`
+	Policies      map[string]string `json:"policies,omitempty"` // rules of each policy read with --policies
+}
+
+// newJSONNode converts the node and its visible children to their json form.
+func newJSONNode(v view, node *secret) *jsonNode {
+	n := &jsonNode{
+		Path:          node.path,
+		Type:          node.nodeType(),
+		Engine:        node.engine,
+		EngineVersion: node.engineVersion,
+		Annotations:   node.annotations,
+	}
+	for _, child := range v.children(node) {
+		n.Children = append(n.Children, newJSONNode(v, child))
+	}
+	return n
+}
+
+// jsonOut writes the keyspace as a nested json document, along with the
+// errors and timing of the crawl and any policies read.
+func jsonOut(w io.Writer, root *secret, v view) error {
+	n := newJSONNode(v, root)
+	n.Errors = crawler.errors
+	n.Requests = crawler.requests
+	n.CrawlSeconds = crawler.duration.Seconds()
+	if len(crawler.policies) > 0 {
+		n.Policies = map[string]string{}
+		for _, p := range crawler.policies {
+			n.Policies[p.Name] = p.Text
+		}
+	}
+	out, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// fromJSONNode converts a json node and its children back to secrets.
+func fromJSONNode(n *jsonNode, parent *secret) *secret {
+	s := &secret{
+		path:          n.Path,
+		parent:        parent,
+		folder:        n.Type != "secret",
+		annotations:   n.Annotations,
+		engine:        n.Engine,
+		engineVersion: n.EngineVersion,
+	}
+	for _, child := range n.Children {
+		s.addChild(fromJSONNode(child, s))
+	}
+	return s
+}
+
+// loadSnapshot reads a keyspace previously written with --format json,
+// restoring the errors and timing of the crawl and the policies read with it.
+func loadSnapshot(name string) (*secret, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var n jsonNode
+	if err := json.Unmarshal(b, &n); err != nil {
+		return nil, fmt.Errorf("%s is not a json snapshot: %s", name, err)
+	}
+	if n.Path == "" {
+		return nil, fmt.Errorf("%s is not a json snapshot: no root path", name)
+	}
+	crawler.errors = n.Errors
+	crawler.requests = n.Requests
+	crawler.duration = time.Duration(n.CrawlSeconds * float64(time.Second))
+	crawler.policies = nil
+	var names []string
+	for name := range n.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, err := parsePolicy(name, n.Policies[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		crawler.policies = append(crawler.policies, p)
+	}
+	return fromJSONNode(&n, nil), nil
+}
@@ -0,0 +1,77 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadSnapshot(t *testing.T) {
+
+	Convey("When a keyspace written with --format json is read back", t, func() {
+		root := testTree()
+		root.engine, root.engineVersion = "kv", "1"
+		root.children[1].annotations = map[string]string{"owner": "ops"}
+		ops, _ := parsePolicy("ops", `path "secret/ops/*" { capabilities = ["read"] }`)
+		crawler.policies = []*aclPolicy{ops}
+		defer func() { crawler.policies = nil }()
+		f, _ := ioutil.TempFile("", "snapshot")
+		defer os.Remove(f.Name())
+		jsonOut(f, root, view{})
+		f.Close()
+		crawler.policies = nil
+		s, err := loadSnapshot(f.Name())
+
+		Convey("The tree should be rebuilt as it was written", func() {
+			So(err, should.BeNil)
+			So(len(view{}.nodes(s)), should.Equal, 6)
+			So(s.children[0].children[0].path, should.Equal, "secret/app-1/db")
+			So(s.children[0].children[0].parent, should.Equal, s.children[0])
+		})
+		Convey("Node types, annotations and the engine should survive", func() {
+			So(s.children[0].nodeType(), should.Equal, "folder")
+			So(s.children[0].children[0].nodeType(), should.Equal, "secret")
+			So(s.children[1].annotations["owner"], should.Equal, "ops")
+			So(s.engine, should.Equal, "kv")
+		})
+		Convey("The policies read with the keyspace should be restored", func() {
+			So(crawler.policies, should.HaveLength, 1)
+			So(crawler.policies[0].Name, should.Equal, "ops")
+			So(crawler.policies[0].Rules[0].Path, should.Equal, "secret/ops/*")
+		})
+	})
+
+	Convey("When the snapshot is not json", t, func() {
+		f, _ := ioutil.TempFile("", "snapshot")
+		defer os.Remove(f.Name())
+		f.WriteString("digraph Vault {}")
+		f.Close()
+		_, err := loadSnapshot(f.Name())
+
+		Convey("An error should be returned", func() {
+			So(err, should.NotBeNil)
+		})
+	})
+}
@@ -0,0 +1,137 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var metricsDepth int      // Deepest prefix below each mount given its own metrics
+var graphitePrefix string // Prefix of every graphite metric name
+
+// metricsTime returns the timestamp of the graphite lines.
+var metricsTime = time.Now
+
+// prefixMetric holds the counts of one mount or folder.
+type prefixMetric struct {
+	mount, prefix string
+	countStats
+}
+
+// subtreeCounts counts the folders and secrets below node, not including
+// node itself.
+func subtreeCounts(node *secret) countStats {
+	var c countStats
+	for _, child := range node.children {
+		if child.nodeType() == "secret" {
+			c.Secrets++
+			continue
+		}
+		c.Folders++
+		sub := subtreeCounts(child)
+		c.Folders += sub.Folders
+		c.Secrets += sub.Secrets
+	}
+	return c
+}
+
+// prefixMetrics returns the counts for every visible mount and folder no
+// deeper than --metrics-depth below its mount.
+func prefixMetrics(v view, root *secret) []prefixMetric {
+	var out []prefixMetric
+	for _, node := range v.nodes(root) {
+		if node.nodeType() == "secret" || node.depth() > metricsDepth {
+			continue
+		}
+		out = append(out, prefixMetric{node.mount(), node.path, subtreeCounts(node)})
+	}
+	return out
+}
+
+// promEscape escapes a prometheus label value.
+var promEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusOut writes the keyspace metrics in the prometheus text exposition
+// format, ready for the node_exporter textfile collector.
+func prometheusOut(w io.Writer, root *secret, v view) error {
+	var b bytes.Buffer
+	prefixes := prefixMetrics(v, root)
+	gauge := func(name, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+
+	gauge("vault_keyspace_secrets", "Secrets below the prefix.")
+	for _, p := range prefixes {
+		fmt.Fprintf(&b, "vault_keyspace_secrets{mount=\"%s\",prefix=\"%s\"} %d\n", promEscape.Replace(p.mount), promEscape.Replace(p.prefix), p.Secrets)
+	}
+	gauge("vault_keyspace_folders", "Folders below the prefix.")
+	for _, p := range prefixes {
+		fmt.Fprintf(&b, "vault_keyspace_folders{mount=\"%s\",prefix=\"%s\"} %d\n", promEscape.Replace(p.mount), promEscape.Replace(p.prefix), p.Folders)
+	}
+	gauge("vault_keyspace_crawl_duration_seconds", "Time taken to crawl the keyspace.")
+	fmt.Fprintf(&b, "vault_keyspace_crawl_duration_seconds %g\n", crawler.duration.Seconds())
+	gauge("vault_keyspace_crawl_list_requests", "LIST requests sent while crawling.")
+	fmt.Fprintf(&b, "vault_keyspace_crawl_list_requests %d\n", crawler.requests)
+	gauge("vault_keyspace_crawl_errors", "Requests that failed while crawling.")
+	fmt.Fprintf(&b, "vault_keyspace_crawl_errors %d\n", len(crawler.errors))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// graphiteUnsafe matches the characters not allowed in a graphite metric
+// name element.
+var graphiteUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// graphiteName turns a vault path into dot separated graphite name elements.
+func graphiteName(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range parts {
+		parts[i] = graphiteUnsafe.ReplaceAllString(p, "_")
+	}
+	return strings.Join(parts, ".")
+}
+
+// graphiteOut writes the keyspace metrics as graphite plaintext protocol
+// lines, all stamped with the same time.
+func graphiteOut(w io.Writer, root *secret, v view) error {
+	var b bytes.Buffer
+	now := metricsTime().Unix()
+	line := func(name string, value interface{}) {
+		fmt.Fprintf(&b, "%s.%s %v %d\n", graphitePrefix, name, value, now)
+	}
+
+	for _, p := range prefixMetrics(v, root) {
+		line("paths."+graphiteName(p.prefix)+".secrets", p.Secrets)
+		line("paths."+graphiteName(p.prefix)+".folders", p.Folders)
+	}
+	line("crawl.duration_seconds", crawler.duration.Seconds())
+	line("crawl.list_requests", crawler.requests)
+	line("crawl.errors", len(crawler.errors))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
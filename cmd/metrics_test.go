@@ -0,0 +1,68 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestMetricsOut(t *testing.T) {
+
+	Convey("When writing metrics for a crawled keyspace", t, func() {
+		metricsDepth, graphitePrefix = 1, "vault.keyspace"
+		crawler.requests, crawler.duration, crawler.errors = 4, 1500*time.Millisecond, []crawlError{{"secret/x", "denied"}}
+		defer func() { crawler.requests, crawler.duration, crawler.errors = 0, 0, nil }()
+		metricsTime = func() time.Time { return time.Unix(1500000000, 0) }
+		defer func() { metricsTime = time.Now }()
+		root := buildTree("secret/app/", "secret/app/db", "secret/app/deep/", "secret/app/deep/key", "secret/top")
+
+		Convey("Prefixes should stop at the metrics depth", func() {
+			So(prefixMetrics(view{}, root), should.Resemble, []prefixMetric{
+				{"secret", "secret", countStats{Folders: 2, Secrets: 3}},
+				{"secret", "secret/app", countStats{Folders: 1, Secrets: 2}},
+			})
+		})
+		Convey("The prometheus output should hold labelled gauges", func() {
+			var b bytes.Buffer
+			So(prometheusOut(&b, root, view{}), should.BeNil)
+			So(b.String(), should.ContainSubstring, "# TYPE vault_keyspace_secrets gauge\n")
+			So(b.String(), should.ContainSubstring, "vault_keyspace_secrets{mount=\"secret\",prefix=\"secret/app\"} 2\n")
+			So(b.String(), should.ContainSubstring, "vault_keyspace_folders{mount=\"secret\",prefix=\"secret\"} 2\n")
+			So(b.String(), should.ContainSubstring, "vault_keyspace_crawl_duration_seconds 1.5\n")
+			So(b.String(), should.ContainSubstring, "vault_keyspace_crawl_list_requests 4\n")
+			So(b.String(), should.ContainSubstring, "vault_keyspace_crawl_errors 1\n")
+		})
+		Convey("The graphite output should hold timestamped lines", func() {
+			var b bytes.Buffer
+			So(graphiteOut(&b, root, view{}), should.BeNil)
+			So(b.String(), should.ContainSubstring, "vault.keyspace.paths.secret.app.secrets 2 1500000000\n")
+			So(b.String(), should.ContainSubstring, "vault.keyspace.crawl.errors 1 1500000000\n")
+		})
+	})
+
+	Convey("Graphite names should not contain unsafe characters", t, func() {
+		So(graphiteName("secret/my app/v1.2"), should.Equal, "secret.my_app.v1_2")
+	})
+}
@@ -0,0 +1,288 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	gph "github.com/awalterschulze/gographviz"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// renderer writes the keyspace below root to w in a single output format.
+type renderer func(w io.Writer, root *secret, v view) error
+
+// renderers maps the values accepted by --format to the function producing
+// that format.
+var renderers = map[string]renderer{
+	"dot":              dotOut,
+	"mermaid":          mermaidOut,
+	"mermaid-mindmap":  mermaidMindmapOut,
+	"plantuml":         plantumlOut,
+	"plantuml-mindmap": plantumlMindmapOut,
+	"d2":               d2Out,
+	"graphml":          graphmlOut,
+	"gexf":             gexfOut,
+	"cytoscape":        cytoscapeOut,
+	"tree":             treeOut,
+	"csv":              csvOut,
+	"tsv":              tsvOut,
+	"ndjson":           ndjsonOut,
+	"json":             jsonOut,
+	"treemap":          treemapOut,
+	"sunburst":         sunburstOut,
+	"template":         templateOut,
+	"prometheus":       prometheusOut,
+	"graphite":         graphiteOut,
+	"policy-graph":     policyGraphOut,
+}
+
+// extensions maps each format to the file extension used in --output-dir.
+var extensions = map[string]string{
+	"dot":              "dot",
+	"mermaid":          "mmd",
+	"mermaid-mindmap":  "mindmap.mmd",
+	"plantuml":         "puml",
+	"plantuml-mindmap": "mindmap.puml",
+	"d2":               "d2",
+	"graphml":          "graphml",
+	"gexf":             "gexf",
+	"cytoscape":        "cyjs",
+	"tree":             "txt",
+	"csv":              "csv",
+	"tsv":              "tsv",
+	"ndjson":           "ndjson",
+	"json":             "json",
+	"treemap":          "svg",
+	"sunburst":         "html",
+	"template":         "txt",
+	"prometheus":       "prom",
+	"graphite":         "graphite",
+	"policy-graph":     "policy.dot",
+}
+
+// manifestEntry describes one file written to --output-dir.
+type manifestEntry struct {
+	Format string `json:"format"`
+	Page   string `json:"page"` // subtree drawn in the file, or index
+	File   string `json:"file"`
+	Bytes  int    `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifest lists everything a single run wrote to --output-dir.
+type manifest struct {
+	Version   string          `json:"version"`
+	Generated time.Time       `json:"generated"`
+	Root      string          `json:"root"`
+	Files     []manifestEntry `json:"files"`
+}
+
+// formatList splits the --format flag into its formats and checks that each
+// of them is known.
+func formatList(s string) ([]string, error) {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if _, ok := renderers[f]; !ok {
+			return nil, fmt.Errorf("unknown output format %q", f)
+		}
+		out = append(out, f)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no output format given")
+	}
+	return out, nil
+}
+
+// render writes the nodes of the keyspace below root that are visible in the
+// view to w using the named format.
+func render(name string, w io.Writer, root *secret, v view) error {
+	r, ok := renderers[name]
+	if !ok {
+		return fmt.Errorf("unknown output format %q", name)
+	}
+	if simplifying() && graphFormats[name] {
+		// The simplified copy only holds visible nodes and its depths no
+		// longer match the keyspace, so draw all of it.
+		return r(w, simplify(v, root), view{})
+	}
+	return r(w, root, v)
+}
+
+// writeAtomic writes data to a temporary file next to name and renames it into
+// place, so readers never see a partially written file.
+func writeAtomic(name string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fileMode(name))
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// fileMode returns the permissions of the file at name, so that replacing it
+// keeps them, or 0644 for a new file.
+func fileMode(name string) os.FileMode {
+	if fi, err := os.Stat(name); err == nil {
+		return fi.Mode().Perm()
+	}
+	return 0644
+}
+
+// appendFile appends data to name, creating it if needed.
+func appendFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeRendered renders node in the named format to dir/name and records the
+// file in the manifest.
+func writeRendered(dir string, f string, node *secret, v view, name string, page string, m *manifest) error {
+	var b bytes.Buffer
+	if err := render(f, &b, node, v); err != nil {
+		return err
+	}
+	if err := writeAtomic(filepath.Join(dir, name), b.Bytes()); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b.Bytes())
+	m.Files = append(m.Files, manifestEntry{
+		Format: f,
+		Page:   page,
+		File:   name,
+		Bytes:  b.Len(),
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+	return nil
+}
+
+// writeOutputDir renders every format into dir, named after the root of the
+// crawl, and finishes with a manifest.json describing what was written. With
+// --paged each subtree gets its own file plus an index linking to them.
+func writeOutputDir(dir string, formats []string, root *secret, v view) error {
+	pages, err := pageRoots(v, root)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	m := manifest{
+		Version:   version.AppVersion(),
+		Generated: time.Now().UTC(),
+		Root:      root.path,
+	}
+	for _, f := range formats {
+		for _, p := range pages {
+			if err := writeRendered(dir, f, p, v, pageFile(p, extensions[f]), p.path, &m); err != nil {
+				return err
+			}
+		}
+		if paged == "" {
+			continue
+		}
+		ext := extensions[f]
+		if linkExt != "" {
+			ext = linkExt
+		}
+		// The index only holds visible nodes, so draw all of it.
+		index := pageIndex(v, root, pages, ext)
+		if err := writeRendered(dir, f, index, view{}, "index."+extensions[f], "index", &m); err != nil {
+			return err
+		}
+	}
+	out, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(dir, "manifest.json"), append(out, '\n'))
+}
+
+// dotOut writes the keyspace as a graphviz digraph styled by the --theme.
+func dotOut(w io.Writer, root *secret, v view) error {
+	t, err := loadTheme(themeName)
+	if err != nil {
+		return err
+	}
+	graph := gph.NewGraph()
+	graph.SetDir(true)
+	graph.SetName("Vault")
+	var cl clusters
+	sub := "Vault"
+	if cluster == "mount" || cluster == "folder" {
+		sub = cl.add(graph, root, "Vault", "#f1f3f4")
+	} else if cluster != "none" {
+		return fmt.Errorf("unknown cluster mode %q", cluster)
+	}
+
+	graph.AddNode(sub, dotQuote(root.path), dotAttrs(t, root))
+	for i, child := range v.children(root) {
+		childSub := sub
+		if cluster == "folder" && child.nodeType() == "folder" {
+			childSub = cl.add(graph, child, sub, clusterColors[i%len(clusterColors)])
+		}
+		graphOut(graph, t, v, child, dotQuote(root.path), childSub)
+	}
+	if legend {
+		legendOut(graph, t)
+	}
+
+	a := graph.WriteAst()
+	if err := cl.nest(a); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, a.String())
+	return err
+}
@@ -0,0 +1,189 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatList(t *testing.T) {
+
+	Convey("When the format flag lists several known formats", t, func() {
+		f, err := formatList("dot, json,csv")
+
+		Convey("Each format should be returned in order", func() {
+			So(err, should.BeNil)
+			So(f, should.Resemble, []string{"dot", "json", "csv"})
+		})
+	})
+
+	Convey("When the format flag contains an unknown format", t, func() {
+		_, err := formatList("dot,png")
+
+		Convey("An error naming the format should be returned", func() {
+			So(err, should.NotBeNil)
+			So(err.Error(), should.ContainSubstring, "png")
+		})
+	})
+}
+
+func TestWriteAtomic(t *testing.T) {
+
+	Convey("When the same file is written twice", t, func() {
+		dir, _ := ioutil.TempDir("", "vaultVisualize")
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "out.txt")
+		writeAtomic(name, []byte("one\n"))
+		err := writeAtomic(name, []byte("two\n"))
+		b, _ := ioutil.ReadFile(name)
+		files, _ := ioutil.ReadDir(dir)
+
+		Convey("The file should only hold the second write", func() {
+			So(err, should.BeNil)
+			So(string(b), should.Equal, "two\n")
+		})
+		Convey("No temporary files should be left behind", func() {
+			So(len(files), should.Equal, 1)
+		})
+	})
+
+	Convey("When a file with restricted permissions is replaced", t, func() {
+		dir, _ := ioutil.TempDir("", "vaultVisualize")
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "out.txt")
+		ioutil.WriteFile(name, []byte("one\n"), 0600)
+		os.Chmod(name, 0600)
+		err := writeAtomic(name, []byte("two\n"))
+		fi, _ := os.Stat(name)
+
+		Convey("The file should keep its permissions", func() {
+			So(err, should.BeNil)
+			So(fi.Mode().Perm(), should.Equal, os.FileMode(0600))
+		})
+	})
+
+	Convey("When the same file is appended to twice", t, func() {
+		dir, _ := ioutil.TempDir("", "vaultVisualize")
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "out.txt")
+		appendFile(name, []byte("one\n"))
+		appendFile(name, []byte("two\n"))
+		b, _ := ioutil.ReadFile(name)
+
+		Convey("The file should hold both writes", func() {
+			So(string(b), should.Equal, "one\ntwo\n")
+		})
+	})
+}
+
+func TestWriteOutputDir(t *testing.T) {
+
+	Convey("When writing several formats to an output directory", t, func() {
+		dir, _ := ioutil.TempDir("", "vaultVisualize")
+		defer os.RemoveAll(dir)
+		err := writeOutputDir(dir, []string{"dot", "json", "csv"}, testTree(), view{})
+		var m manifest
+		b, _ := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+		json.Unmarshal(b, &m)
+
+		Convey("Every format should be written next to a manifest", func() {
+			So(err, should.BeNil)
+			for _, name := range []string{"secret.dot", "secret.json", "secret.csv", "manifest.json"} {
+				_, err := os.Stat(filepath.Join(dir, name))
+				So(err, should.BeNil)
+			}
+		})
+		Convey("The manifest should list each file with its size", func() {
+			So(len(m.Files), should.Equal, 3)
+			So(m.Files[1].File, should.Equal, "secret.json")
+			fi, _ := os.Stat(filepath.Join(dir, "secret.json"))
+			So(m.Files[1].Bytes, should.Equal, fi.Size())
+		})
+	})
+}
+
+func TestDotOut(t *testing.T) {
+
+	Convey("When rendering the test tree with the type theme", t, func() {
+		themeName, legend, cluster = "type", true, "none"
+		var b bytes.Buffer
+		err := dotOut(&b, testTree(), view{})
+		themeName = "plain"
+
+		Convey("Keys with the same name in different folders should be separate nodes", func() {
+			So(err, should.BeNil)
+			So(b.String(), should.ContainSubstring, "\"secret/app-1/db\"")
+			So(b.String(), should.ContainSubstring, "\"secret/ops/db\"")
+		})
+		Convey("A legend subgraph should explain the styles", func() {
+			So(b.String(), should.ContainSubstring, "subgraph cluster_legend")
+			So(b.String(), should.ContainSubstring, "label=\"folder\"")
+		})
+	})
+
+	Convey("When rendering the test tree with the plain theme", t, func() {
+		themeName, legend = "plain", true
+		var b bytes.Buffer
+		dotOut(&b, testTree(), view{})
+
+		Convey("Nodes should be bold and there should be no legend", func() {
+			So(b.String(), should.ContainSubstring, "style=\"bold\"")
+			So(b.String(), should.NotContainSubstring, "cluster_legend")
+		})
+	})
+
+	Convey("When rendering the test tree with --cluster folder", t, func() {
+		themeName, legend, cluster = "plain", true, "folder"
+		var b bytes.Buffer
+		err := dotOut(&b, testTree(), view{})
+		cluster = "none"
+		out := b.String()
+
+		Convey("The mount should be wrapped in a cluster", func() {
+			So(err, should.BeNil)
+			So(out, should.ContainSubstring, "subgraph \"cluster_secret\" {")
+		})
+		Convey("Each first level folder should be a cluster inside the mount cluster", func() {
+			mount := strings.Index(out, "subgraph \"cluster_secret\" {")
+			app := strings.Index(out, "subgraph \"cluster_secret/app-1\" {")
+			So(app, should.BeGreaterThan, mount)
+			So(strings.Count(out[mount:], "subgraph"), should.Equal, 3)
+		})
+	})
+
+	Convey("When the cluster mode is unknown", t, func() {
+		cluster = "team"
+		err := dotOut(&bytes.Buffer{}, testTree(), view{})
+		cluster = "none"
+
+		Convey("An error should be returned", func() {
+			So(err, should.NotBeNil)
+		})
+	})
+}
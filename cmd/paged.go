@@ -0,0 +1,91 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pageRoots returns the subtrees that get their own file for the --paged mode.
+func pageRoots(v view, root *secret) ([]*secret, error) {
+	switch paged {
+	case "", "mount":
+		return []*secret{root}, nil
+	case "folder":
+		var pages []*secret
+		for _, child := range v.children(root) {
+			if child.folder {
+				pages = append(pages, child)
+			}
+		}
+		return pages, nil
+	}
+	return nil, fmt.Errorf("unknown paged mode %q", paged)
+}
+
+// pageFile returns the name of the file a subtree is written to.
+func pageFile(page *secret, ext string) string {
+	return strings.Replace(page.path, "/", "_", -1) + "." + ext
+}
+
+// pageIndex builds the tree drawn in the index of a paged output. Every page
+// becomes a single node linking to the page file with the extension ext,
+// secrets that are not in any page are drawn as they are.
+func pageIndex(v view, root *secret, pages []*secret, ext string) *secret {
+	isPage := map[*secret]bool{}
+	for _, p := range pages {
+		isPage[p] = true
+	}
+	pageNode := func(p *secret, parent *secret) *secret {
+		return &secret{
+			path:        p.path,
+			parent:      parent,
+			folder:      true,
+			label:       fmt.Sprintf("%s (%d secrets)", p.name(), p.leafCount()),
+			summary:     p.leafCount(),
+			annotations: map[string]string{"url": pageFile(p, ext)},
+		}
+	}
+
+	if paged == "mount" {
+		index := &secret{path: "vault", folder: true}
+		for _, p := range pages {
+			index.addChild(pageNode(p, index))
+		}
+		return index
+	}
+
+	index := &secret{
+		path:          root.path,
+		folder:        true,
+		engine:        root.engine,
+		engineVersion: root.engineVersion,
+	}
+	for _, child := range v.children(root) {
+		if isPage[child] {
+			index.addChild(pageNode(child, index))
+		} else {
+			index.addChild(&secret{path: child.path, parent: index, folder: child.folder})
+		}
+	}
+	return index
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPagedOutput(t *testing.T) {
+
+	Convey("When writing a paged output per first level folder", t, func() {
+		paged, linkExt = "folder", ""
+		dir, _ := ioutil.TempDir("", "vaultVisualize")
+		defer os.RemoveAll(dir)
+		root := buildTree("secret/app-1/", "secret/app-1/db", "secret/ops/", "secret/ops/db", "secret/loose")
+		err := writeOutputDir(dir, []string{"dot", "mermaid"}, root, view{})
+		paged = ""
+
+		Convey("Each folder should get its own diagram in every format", func() {
+			So(err, should.BeNil)
+			for _, name := range []string{"secret_app-1.dot", "secret_ops.dot", "secret_app-1.mmd", "secret_ops.mmd", "index.dot", "index.mmd"} {
+				_, err := os.Stat(filepath.Join(dir, name))
+				So(err, should.BeNil)
+			}
+		})
+		Convey("A folder page should only hold its own subtree", func() {
+			b, _ := ioutil.ReadFile(filepath.Join(dir, "secret_ops.dot"))
+			So(string(b), should.ContainSubstring, "\"secret/ops/db\"")
+			So(string(b), should.NotContainSubstring, "app-1")
+		})
+		Convey("The index should link every folder to its page", func() {
+			dot, _ := ioutil.ReadFile(filepath.Join(dir, "index.dot"))
+			So(string(dot), should.ContainSubstring, "URL=\"secret_app-1.dot\"")
+			So(string(dot), should.ContainSubstring, "label=\"ops (1 secrets)\"")
+			mmd, _ := ioutil.ReadFile(filepath.Join(dir, "index.mmd"))
+			So(string(mmd), should.ContainSubstring, "href \"secret_ops.mmd\"")
+		})
+		Convey("Secrets outside any folder should still be in the index", func() {
+			dot, _ := ioutil.ReadFile(filepath.Join(dir, "index.dot"))
+			So(string(dot), should.ContainSubstring, "\"secret/loose\"")
+		})
+	})
+
+	Convey("When the index should link to rendered svg files", t, func() {
+		paged, linkExt = "folder", "svg"
+		dir, _ := ioutil.TempDir("", "vaultVisualize")
+		defer os.RemoveAll(dir)
+		writeOutputDir(dir, []string{"dot"}, testTree(), view{})
+		paged, linkExt = "", ""
+		dot, _ := ioutil.ReadFile(filepath.Join(dir, "index.dot"))
+
+		Convey("The links should use the svg extension", func() {
+			So(string(dot), should.ContainSubstring, "URL=\"secret_app-1.svg\"")
+		})
+	})
+}
@@ -0,0 +1,370 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/api"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"sort"
+	"strings"
+)
+
+var policyOverlay bool // Annotate the keyspace with the policies that apply to it
+
+// capabilityOrder is the order capabilities are listed in.
+var capabilityOrder = []string{"create", "read", "update", "delete", "list", "sudo", "deny"}
+
+// legacyCapabilities maps the policy field of old style rules onto the
+// capabilities it stands for.
+var legacyCapabilities = map[string][]string{
+	"deny":  {"deny"},
+	"read":  {"read", "list"},
+	"write": {"create", "read", "update", "delete", "list"},
+	"sudo":  {"create", "read", "update", "delete", "list", "sudo"},
+}
+
+// policyRule is a single path block of an ACL policy.
+type policyRule struct {
+	Path         string   `json:"path"` // as written in the policy
+	Capabilities []string `json:"capabilities"`
+
+	glob     bool     // the path ends in *, matching any path it prefixes
+	segments []string // the path without the *, split on /
+}
+
+// aclPolicy is a named, parsed ACL policy.
+type aclPolicy struct {
+	Name  string
+	Rules []policyRule
+	Text  string // the rules as written
+}
+
+// grant is the rule of a single policy that applies to a path.
+type grant struct {
+	Policy string
+	Rule   policyRule
+}
+
+// newPolicyRule returns the rule for path with the given capabilities.
+func newPolicyRule(path string, caps []string) policyRule {
+	r := policyRule{Path: path, Capabilities: sortCapabilities(caps)}
+	p := strings.TrimPrefix(path, "/")
+	if strings.HasSuffix(p, "*") {
+		r.glob = true
+		p = strings.TrimSuffix(p, "*")
+	}
+	r.segments = strings.Split(p, "/")
+	return r
+}
+
+// parsePolicy parses the HCL (or json) rules of a policy the way vault does,
+// accepting both capabilities lists and the old policy field.
+func parsePolicy(name, rules string) (*aclPolicy, error) {
+	f, err := hcl.Parse(rules)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse policy %q: %s", name, err)
+	}
+	list, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("could not parse policy %q: no root object", name)
+	}
+	p := &aclPolicy{Name: name, Text: rules}
+	for _, item := range list.Filter("path").Items {
+		if len(item.Keys) == 0 {
+			return nil, fmt.Errorf("policy %q has a path block without a path", name)
+		}
+		path, _ := item.Keys[0].Token.Value().(string)
+		var body struct {
+			Policy       string   `hcl:"policy"`
+			Capabilities []string `hcl:"capabilities"`
+		}
+		if err := hcl.DecodeObject(&body, item.Val); err != nil {
+			return nil, fmt.Errorf("policy %q path %q: %s", name, path, err)
+		}
+		caps := body.Capabilities
+		if body.Policy != "" {
+			legacy, ok := legacyCapabilities[body.Policy]
+			if !ok {
+				return nil, fmt.Errorf("policy %q path %q: unknown policy %q", name, path, body.Policy)
+			}
+			caps = append(caps, legacy...)
+		}
+		for _, c := range caps {
+			if capabilityRank(c) < 0 {
+				return nil, fmt.Errorf("policy %q path %q: unknown capability %q", name, path, c)
+			}
+		}
+		p.Rules = append(p.Rules, newPolicyRule(path, caps))
+	}
+	return p, nil
+}
+
+// capabilityRank returns the position of c in capabilityOrder, or -1.
+func capabilityRank(c string) int {
+	for i, o := range capabilityOrder {
+		if o == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortCapabilities returns the capabilities without duplicates in
+// capabilityOrder, reduced to deny when deny is one of them.
+func sortCapabilities(caps []string) []string {
+	seen := map[string]bool{}
+	for _, c := range caps {
+		seen[c] = true
+	}
+	if seen["deny"] {
+		return []string{"deny"}
+	}
+	out := []string{}
+	for _, c := range capabilityOrder {
+		if seen[c] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// matches reports whether the rule applies to path, where + matches exactly
+// one path segment and a trailing * any suffix.
+func (r policyRule) matches(path string) bool {
+	parts := strings.Split(path, "/")
+	n := len(r.segments)
+	if len(parts) < n || !r.glob && len(parts) != n {
+		return false
+	}
+	for i, s := range r.segments {
+		switch {
+		case s == "+":
+		case i == n-1 && r.glob:
+			if !strings.HasPrefix(parts[i], s) {
+				return false
+			}
+		case s != parts[i]:
+			return false
+		}
+	}
+	return true
+}
+
+// wildcard returns the position of the first + or * in the rule path.
+func (r policyRule) wildcard() int {
+	p := strings.TrimPrefix(r.Path, "/")
+	if i := strings.IndexAny(p, "+*"); i >= 0 {
+		return i
+	}
+	return len(p) + 1
+}
+
+// plusCount returns the number of + segments in the rule path.
+func (r policyRule) plusCount() int {
+	n := 0
+	for _, s := range r.segments {
+		if s == "+" {
+			n++
+		}
+	}
+	return n
+}
+
+// lowerPriority reports whether vault prefers rule o over r when both match
+// the same path: the later the first wildcard, then no trailing *, then
+// fewer + segments, then the longer path, then the lexically greater path.
+func (r policyRule) lowerPriority(o policyRule) bool {
+	if r.wildcard() != o.wildcard() {
+		return r.wildcard() < o.wildcard()
+	}
+	if r.glob != o.glob {
+		return r.glob
+	}
+	if r.plusCount() != o.plusCount() {
+		return r.plusCount() > o.plusCount()
+	}
+	if len(r.Path) != len(o.Path) {
+		return len(r.Path) < len(o.Path)
+	}
+	return r.Path < o.Path
+}
+
+// matching returns every rule of the policy that matches path, the one
+// vault applies first.
+func (p *aclPolicy) matching(path string) []policyRule {
+	var out []policyRule
+	for _, r := range p.Rules {
+		if r.matches(path) {
+			out = append(out, r)
+		}
+	}
+	sort.Sort(byPriority(out))
+	return out
+}
+
+// match returns the rule of the policy that applies to path.
+func (p *aclPolicy) match(path string) (policyRule, bool) {
+	rules := p.matching(path)
+	if len(rules) == 0 {
+		return policyRule{}, false
+	}
+	return rules[0], true
+}
+
+// byPriority sorts rules from the one vault prefers down.
+type byPriority []policyRule
+
+func (b byPriority) Len() int           { return len(b) }
+func (b byPriority) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byPriority) Less(i, j int) bool { return b[j].lowerPriority(b[i]) }
+
+// policyGrants returns the rules vault applies to path once the policies are
+// merged into one ACL: the highest priority rule matching path across all of
+// them, along with every rule, in any policy, written for the same path.
+func policyGrants(policies []*aclPolicy, path string) []grant {
+	var matching []grant
+	for _, p := range policies {
+		for _, r := range p.matching(path) {
+			matching = append(matching, grant{p.Name, r})
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+	best := matching[0].Rule
+	for _, g := range matching[1:] {
+		if best.lowerPriority(g.Rule) {
+			best = g.Rule
+		}
+	}
+	var out []grant
+	for _, g := range matching {
+		if g.Rule.samePath(best) {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// samePath reports whether both rules were written for the same path, which
+// vault merges into a single rule.
+func (r policyRule) samePath(o policyRule) bool {
+	return strings.TrimPrefix(r.Path, "/") == strings.TrimPrefix(o.Path, "/")
+}
+
+// effectiveCapabilities merges the rules vault applies to a path: the union
+// of their capabilities, unless any of them denies it.
+func effectiveCapabilities(grants []grant) []string {
+	var caps []string
+	for _, g := range grants {
+		caps = append(caps, g.Rule.Capabilities...)
+	}
+	return sortCapabilities(caps)
+}
+
+// aclPath returns the path vault checks policies against for the node.
+// Folders are listed with a trailing slash.
+func (s *secret) aclPath() string {
+	if s.nodeType() == "secret" {
+		return s.path
+	}
+	return s.path + "/"
+}
+
+// fetchPolicies reads and parses every ACL policy in vault. The root policy
+// has no rules to read and is left out.
+func fetchPolicies(cli *api.Client) ([]*aclPolicy, error) {
+	names, err := cli.Sys().ListPolicies()
+	if err != nil {
+		return nil, fmt.Errorf("could not list policies: %s", err)
+	}
+	sort.Strings(names)
+	var out []*aclPolicy
+	for _, name := range names {
+		if name == "root" {
+			continue
+		}
+		rules, err := cli.Sys().GetPolicy(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not read policy %q: %s", name, err)
+		}
+		p, err := parsePolicy(name, rules)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// overlayPolicies annotates every node below root with the policies whose
+// rules vault applies to it and the capabilities they add up to.
+func overlayPolicies(root *secret, policies []*aclPolicy) {
+	grants := policyGrants(policies, root.aclPath())
+	if len(grants) > 0 {
+		var names []string
+		for _, g := range grants {
+			names = append(names, g.Policy)
+		}
+		if root.annotations == nil {
+			root.annotations = map[string]string{}
+		}
+		root.annotations["policies"] = strings.Join(names, ",")
+		root.annotations["capabilities"] = strings.Join(effectiveCapabilities(grants), ",")
+	}
+	for _, child := range root.children {
+		overlayPolicies(child, policies)
+	}
+}
+
+// loadPolicies returns every policy in vault, exiting when they can not be
+// read.
+func loadPolicies() []*aclPolicy {
+	policies, err := fetchPolicies(vaultClient())
+	if err != nil {
+		syslogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   err,
+		}).Error(`Could not read the vault policies`)
+		txtlogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"error":   err,
+		}).Error(`Could not read the vault policies`)
+		sensuutil.Exit("GENERALGOLANGERROR")
+	}
+	return policies
+}
+
+// keyspacePolicies returns the policies stored in the snapshot the keyspace
+// was read from, or read from vault when there are none.
+func keyspacePolicies() []*aclPolicy {
+	if len(crawler.policies) == 0 {
+		crawler.policies = loadPolicies()
+	}
+	return crawler.policies
+}
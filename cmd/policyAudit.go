@@ -0,0 +1,228 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var auditFormat string // Output format of the policy audit
+var skipRoles bool     // Audit without reading the auth roles from vault
+
+// policyRuleRef names a single rule of a policy.
+type policyRuleRef struct {
+	Policy string `json:"policy"`
+	Rule   string `json:"rule"`
+}
+
+// auditReport lists what the policy audit found.
+type auditReport struct {
+	DeadRules    []policyRuleRef `json:"dead_rules"`        // rules for the keyspace matching no existing path
+	Uncovered    []string        `json:"uncovered_secrets"` // secrets no policy grants read on
+	RolesChecked bool            `json:"roles_checked"`
+	Unattached   []string        `json:"unattached_policies"` // policies no role attaches
+	Errors       []crawlError    `json:"errors,omitempty"`
+}
+
+// inKeyspace reports whether the rule is about one of the crawled mounts,
+// rather than about sys, auth or a mount that was not crawled.
+func (r policyRule) inKeyspace(mounts []string) bool {
+	first := r.segments[0]
+	for _, m := range mounts {
+		switch {
+		case first == "+", first == m:
+			return true
+		case r.glob && len(r.segments) == 1 && strings.HasPrefix(m, first):
+			return true
+		}
+	}
+	return false
+}
+
+// auditPolicies cross references the policies with the keyspace below root
+// and, when roles is not nil, with the roles attaching them. A secret is
+// readable when any single policy grants read on it, as a token holding only
+// that policy could read it whatever the other policies say.
+func auditPolicies(root *secret, policies []*aclPolicy, roles []authRole) auditReport {
+	rep := auditReport{DeadRules: []policyRuleRef{}, Uncovered: []string{}, RolesChecked: roles != nil}
+	var nodes []*secret
+	var walk func(node *secret)
+	walk = func(node *secret) {
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(root)
+	mounts := []string{root.mount()}
+
+	for _, p := range policies {
+		for _, r := range p.Rules {
+			if !r.inKeyspace(mounts) {
+				continue
+			}
+			used := false
+			for _, n := range nodes {
+				if used = r.matches(n.aclPath()); used {
+					break
+				}
+			}
+			if !used {
+				rep.DeadRules = append(rep.DeadRules, policyRuleRef{p.Name, r.Path})
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		if n.nodeType() != "secret" {
+			continue
+		}
+		readable := false
+		for _, p := range policies {
+			for _, c := range effectiveCapabilities(policyGrants([]*aclPolicy{p}, n.aclPath())) {
+				readable = readable || c == "read"
+			}
+		}
+		if !readable {
+			rep.Uncovered = append(rep.Uncovered, n.path)
+		}
+	}
+
+	if roles != nil {
+		rep.Unattached = []string{}
+		for _, p := range policies {
+			attached := p.Name == "default"
+			for _, r := range roles {
+				attached = attached || r.attaches(p.Name)
+			}
+			if !attached {
+				rep.Unattached = append(rep.Unattached, p.Name)
+			}
+		}
+	}
+	return rep
+}
+
+// auditText writes the audit as aligned plain text.
+func auditText(w io.Writer, rep auditReport) error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Rules matching no path (%d)\n", len(rep.DeadRules))
+	for _, r := range rep.DeadRules {
+		fmt.Fprintf(tw, "%s\t%s\n", r.Policy, r.Rule)
+	}
+	fmt.Fprintf(tw, "\nSecrets only root can read (%d)\n", len(rep.Uncovered))
+	for _, p := range rep.Uncovered {
+		fmt.Fprintln(tw, p)
+	}
+	if rep.RolesChecked {
+		fmt.Fprintf(tw, "\nPolicies attached to no role (%d)\n", len(rep.Unattached))
+		for _, p := range rep.Unattached {
+			fmt.Fprintln(tw, p)
+		}
+	} else {
+		fmt.Fprintln(tw, "\nPolicies attached to no role: not checked")
+	}
+	if len(rep.Errors) > 0 {
+		fmt.Fprintln(tw, "\nCould not read\tError")
+		for _, e := range rep.Errors {
+			fmt.Fprintf(tw, "%s\t%s\n", e.Path, strings.Replace(e.Error, "\n", " ", -1))
+		}
+	}
+	tw.Flush()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeAudit writes the audit in the given format, text or json.
+func writeAudit(w io.Writer, rep auditReport, f string) error {
+	switch f {
+	case "text":
+		return auditText(w, rep)
+	case "json":
+		out, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	return fmt.Errorf("unknown audit format %q", f)
+}
+
+// policyAuditCmd represents the policy audit command
+var policyAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Find dead policy rules, secrets only root can read and unattached policies",
+	Long: `Cross reference the policies with the keyspace, from a live crawl or a --snapshot, and report the rules
+for the crawled mounts that match no existing path, the secrets no policy grants read on, and the policies no auth
+method role, token role or identity group attaches. The policies stored in the snapshot are used when there are
+any; the roles are always read from vault unless --skip-roles is given.`,
+	Run: func(audit *cobra.Command, args []string) {
+		root := loadTree()
+		policies := keyspacePolicies()
+		var roles []authRole
+		var errs []crawlError
+		var err error
+		if !skipRoles {
+			roles, errs, err = fetchAuthRoles(vaultClient())
+			if roles == nil && err == nil {
+				roles = []authRole{}
+			}
+		}
+		if err == nil {
+			rep := auditPolicies(root, policies, roles)
+			rep.Errors = errs
+			err = writeAudit(os.Stdout, rep, auditFormat)
+		}
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  auditFormat,
+				"error":   err,
+			}).Error(`Could not audit the policies`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  auditFormat,
+				"error":   err,
+			}).Error(`Could not audit the policies`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	policyCmd.AddCommand(policyAuditCmd)
+	policyAuditCmd.Flags().StringVar(&auditFormat, "format", "text", "report format (text, json)")
+	policyAuditCmd.Flags().BoolVar(&skipRoles, "skip-roles", false, "do not read the auth roles from vault, leaving out the unattached policies")
+}
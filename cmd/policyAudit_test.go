@@ -0,0 +1,82 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAuditPolicies(t *testing.T) {
+
+	Convey("When auditing policies against a keyspace", t, func() {
+		root := buildTree("secret/app/", "secret/app/db", "secret/app/api", "secret/hidden")
+		app, _ := parsePolicy("app", `
+path "secret/app/*" { capabilities = ["read", "list"] }
+path "secret/app/api" { capabilities = ["list"] }
+path "secret/gone/*" { capabilities = ["read"] }
+path "sys/mounts" { capabilities = ["read"] }
+`)
+		ops, _ := parsePolicy("ops", `
+path "+/old" { capabilities = ["read"] }
+path "secret/app/db" { capabilities = ["deny"] }
+`)
+		def, _ := parsePolicy("default", `path "auth/token/lookup-self" { capabilities = ["read"] }`)
+		roles := []authRole{{"auth/approle/", "approle", "role", "web", []string{"app"}, true}}
+		rep := auditPolicies(root, []*aclPolicy{app, def, ops}, roles)
+
+		Convey("Keyspace rules matching no path should be reported", func() {
+			So(rep.DeadRules, should.Resemble, []policyRuleRef{{"app", "secret/gone/*"}, {"ops", "+/old"}})
+		})
+		Convey("Secrets no single policy can read should be reported", func() {
+			So(rep.Uncovered, should.Resemble, []string{"secret/app/api", "secret/hidden"})
+		})
+		Convey("Policies no role attaches should be reported, except default", func() {
+			So(rep.RolesChecked, should.BeTrue)
+			So(rep.Unattached, should.Resemble, []string{"ops"})
+		})
+		Convey("The text report should count each finding", func() {
+			var b bytes.Buffer
+			So(writeAudit(&b, rep, "text"), should.BeNil)
+			So(b.String(), should.StartWith, "Rules matching no path (2)\n")
+			So(b.String(), should.ContainSubstring, "Secrets only root can read (2)\n")
+		})
+	})
+
+	Convey("When a second policy has a narrower rule on a readable secret", t, func() {
+		root := buildTree("secret/app/", "secret/app/db")
+		app, _ := parsePolicy("app", `path "secret/app/*" { capabilities = ["read"] }`)
+		ops, _ := parsePolicy("ops", `path "secret/app/db" { capabilities = ["list"] }`)
+		rep := auditPolicies(root, []*aclPolicy{app, ops}, nil)
+
+		Convey("It should not hide the read the first policy grants", func() {
+			So(rep.Uncovered, should.BeEmpty)
+		})
+	})
+
+	Convey("Without roles the unattached policies should not be checked", t, func() {
+		rep := auditPolicies(buildTree("secret/a"), nil, nil)
+		So(rep.RolesChecked, should.BeFalse)
+		So(rep.Unattached, should.BeNil)
+	})
+}
@@ -0,0 +1,241 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+var evalFormat string // Output format of the policy evaluation
+
+// pathCapabilities is a path with the capabilities a policy grants on it.
+type pathCapabilities struct {
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// policyEvaluation compares what a local policy file grants on the keyspace
+// with the live version of the same policy.
+type policyEvaluation struct {
+	Policy  string             `json:"policy"`
+	File    string             `json:"file"`
+	Live    bool               `json:"live"` // whether the snapshot holds a live version to compare with
+	Grants  []pathCapabilities `json:"grants"`
+	Added   []pathCapabilities `json:"newly_granted"`
+	Revoked []pathCapabilities `json:"revoked"`
+}
+
+// granted returns the capabilities the policy grants on path, nothing when
+// no rule matches or the rule denies it.
+func granted(p *aclPolicy, path string) []string {
+	if p == nil {
+		return nil
+	}
+	r, ok := p.match(path)
+	if !ok || len(r.Capabilities) == 1 && r.Capabilities[0] == "deny" {
+		return nil
+	}
+	return r.Capabilities
+}
+
+// capabilityDiff returns the capabilities in a missing from b.
+func capabilityDiff(a, b []string) []string {
+	var out []string
+	for _, c := range a {
+		found := false
+		for _, o := range b {
+			found = found || c == o
+		}
+		if !found {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// evaluatePolicy walks every node below root comparing what the policy
+// grants with what the live policy, if any, grants.
+func evaluatePolicy(root *secret, p, live *aclPolicy, file string) policyEvaluation {
+	ev := policyEvaluation{
+		Policy:  p.Name,
+		File:    file,
+		Live:    live != nil,
+		Grants:  []pathCapabilities{},
+		Added:   []pathCapabilities{},
+		Revoked: []pathCapabilities{},
+	}
+	var walk func(node *secret)
+	walk = func(node *secret) {
+		now, before := granted(p, node.aclPath()), granted(live, node.aclPath())
+		if len(now) > 0 {
+			ev.Grants = append(ev.Grants, pathCapabilities{node.aclPath(), now})
+		}
+		if added := capabilityDiff(now, before); len(added) > 0 {
+			ev.Added = append(ev.Added, pathCapabilities{node.aclPath(), added})
+		}
+		if revoked := capabilityDiff(before, now); len(revoked) > 0 {
+			ev.Revoked = append(ev.Revoked, pathCapabilities{node.aclPath(), revoked})
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return ev
+}
+
+// policyFile reads and parses a local policy, named after the file.
+func policyFile(name string) (*aclPolicy, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parsePolicy(strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)), string(b))
+}
+
+// livePolicy returns the policy with the given name read along with the
+// keyspace, or nil.
+func livePolicy(name string) *aclPolicy {
+	for _, p := range crawler.policies {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// evalText writes the evaluations as aligned plain text.
+func evalText(w io.Writer, evs []policyEvaluation) error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	list := func(title string, paths []pathCapabilities) {
+		fmt.Fprintf(tw, "\n%s (%d)\tCapabilities\n", title, len(paths))
+		for _, p := range paths {
+			fmt.Fprintf(tw, "%s\t%s\n", p.Path, strings.Join(p.Capabilities, ","))
+		}
+	}
+	for i, ev := range evs {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		live := "compared with the live policy"
+		if !ev.Live {
+			live = "not in the snapshot, so everything is new"
+		}
+		fmt.Fprintf(tw, "Policy %s from %s, %s\n", ev.Policy, ev.File, live)
+		list("Newly granted", ev.Added)
+		list("Revoked", ev.Revoked)
+		list("Grants", ev.Grants)
+	}
+	tw.Flush()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeEval writes the evaluations in the given format, text or json.
+func writeEval(w io.Writer, evs []policyEvaluation, f string) error {
+	switch f {
+	case "text":
+		return evalText(w, evs)
+	case "json":
+		out, err := json.MarshalIndent(evs, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	return fmt.Errorf("unknown eval format %q", f)
+}
+
+// policyCmd represents the policy command
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Work with vault ACL policies against the keyspace",
+}
+
+// policyEvalCmd represents the policy eval command
+var policyEvalCmd = &cobra.Command{
+	Use:   "eval <file.hcl>...",
+	Short: "Evaluate local policy files against a keyspace snapshot",
+	Long: `Report the paths of a --snapshot each local policy file grants, and the capabilities it newly grants or
+revokes compared with the live policy of the same name stored in the snapshot (written with --policies). Each
+policy is named after its file. No connection to vault is made.`,
+	Run: func(eval *cobra.Command, args []string) {
+		var evs []policyEvaluation
+		var err error
+		switch {
+		case snapshot == "":
+			err = fmt.Errorf("policy eval needs a --snapshot")
+		case len(args) == 0:
+			err = fmt.Errorf("policy eval needs at least one policy file")
+		}
+		var root *secret
+		if err == nil {
+			root, err = loadSnapshot(snapshot)
+		}
+		for _, f := range args {
+			if err != nil {
+				break
+			}
+			var p *aclPolicy
+			if p, err = policyFile(f); err == nil {
+				evs = append(evs, evaluatePolicy(root, p, livePolicy(p.Name), f))
+			}
+		}
+		if err == nil {
+			err = writeEval(os.Stdout, evs, evalFormat)
+		}
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  evalFormat,
+				"error":   err,
+			}).Error(`Could not evaluate the policies`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  evalFormat,
+				"error":   err,
+			}).Error(`Could not evaluate the policies`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyEvalCmd)
+	policyEvalCmd.Flags().StringVar(&evalFormat, "format", "text", "report format (text, json)")
+}
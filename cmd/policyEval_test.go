@@ -0,0 +1,78 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEvaluatePolicy(t *testing.T) {
+
+	Convey("When evaluating a changed policy against a keyspace", t, func() {
+		root := buildTree("secret/app/", "secret/app/db", "secret/app/api", "secret/ops/", "secret/ops/key")
+		live, _ := parsePolicy("app", `
+path "secret/app/*" { capabilities = ["read", "list"] }
+path "secret/ops/key" { capabilities = ["read"] }
+`)
+		changed, _ := parsePolicy("app", `
+path "secret/app/*" { capabilities = ["read", "list"] }
+path "secret/app/db" { capabilities = ["read", "update"] }
+path "secret/app/api" { capabilities = ["deny"] }
+`)
+		ev := evaluatePolicy(root, changed, live, "app.hcl")
+
+		Convey("Every path the policy grants should be listed", func() {
+			So(ev.Live, should.BeTrue)
+			So(ev.Grants, should.Resemble, []pathCapabilities{
+				{"secret/app/", []string{"read", "list"}},
+				{"secret/app/db", []string{"read", "update"}},
+			})
+		})
+		Convey("New capabilities should be reported as newly granted", func() {
+			So(ev.Added, should.Resemble, []pathCapabilities{{"secret/app/db", []string{"update"}}})
+		})
+		Convey("Lost capabilities, including denied ones, should be reported as revoked", func() {
+			So(ev.Revoked, should.Resemble, []pathCapabilities{
+				{"secret/app/db", []string{"list"}},
+				{"secret/app/api", []string{"read", "list"}},
+				{"secret/ops/key", []string{"read"}},
+			})
+		})
+		Convey("The text report should list each section", func() {
+			var b bytes.Buffer
+			So(writeEval(&b, []policyEvaluation{ev}, "text"), should.BeNil)
+			So(b.String(), should.StartWith, "Policy app from app.hcl, compared with the live policy\n")
+			So(b.String(), should.ContainSubstring, "Revoked (3)")
+		})
+	})
+
+	Convey("A policy missing from the snapshot should only add capabilities", t, func() {
+		root := buildTree("secret/app/", "secret/app/db")
+		p, _ := parsePolicy("new", `path "secret/app/db" { capabilities = ["read"] }`)
+		ev := evaluatePolicy(root, p, nil, "new.hcl")
+		So(ev.Live, should.BeFalse)
+		So(ev.Added, should.Resemble, ev.Grants)
+		So(ev.Revoked, should.BeEmpty)
+	})
+}
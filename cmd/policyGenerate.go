@@ -0,0 +1,246 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"os"
+	pth "path"
+	"sort"
+	"strings"
+)
+
+var generatePaths []string // Globs selecting the paths to grant access to
+var generateCaps string    // Capabilities granted on the selected paths
+var forSelf bool           // Print the policy vaultVisualize needs instead
+
+// crawlRoots are the mounts vaultVisualize crawls.
+var crawlRoots = []string{"secret"}
+
+// selectMatch reports whether path matches the glob, where ** matches any
+// number of path segments and the other segments match as in path.Match.
+func selectMatch(glob, path string) bool {
+	return segmentsMatch(strings.Split(strings.Trim(glob, "/"), "/"), strings.Split(path, "/"))
+}
+
+// segmentsMatch matches path segments against glob segments.
+func segmentsMatch(glob, parts []string) bool {
+	if len(glob) == 0 {
+		return len(parts) == 0
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if segmentsMatch(glob[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := pth.Match(glob[0], parts[0]); !ok {
+		return false
+	}
+	return segmentsMatch(glob[1:], parts[1:])
+}
+
+// hclRule is a path block of a generated policy.
+type hclRule struct {
+	path string
+	caps []string
+}
+
+// withoutList returns the capabilities without list, which does nothing on
+// a secret.
+func withoutList(caps []string) []string {
+	var out []string
+	for _, c := range caps {
+		if c != "list" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// generatePolicy returns the smallest set of rules granting caps on every
+// node below root matching one of the globs, and list on the folders above
+// them. A folder whose whole subtree is selected becomes a single glob rule.
+func generatePolicy(root *secret, globs, caps []string) []hclRule {
+	selected := func(n *secret) bool {
+		for _, g := range globs {
+			if selectMatch(g, n.path) {
+				return true
+			}
+		}
+		return false
+	}
+	rules := map[string][]string{}
+	add := func(path string, c []string) {
+		if len(c) > 0 {
+			rules[path] = sortCapabilities(append(rules[path], c...))
+		}
+	}
+
+	// walk returns whether the node and everything below it are selected,
+	// adding rules for the selected nodes of partly selected subtrees.
+	var walk func(n *secret) (all, any bool)
+	walk = func(n *secret) (bool, bool) {
+		all, any := selected(n), selected(n)
+		var full []*secret
+		for _, child := range n.children {
+			a, s := walk(child)
+			all = all && a
+			any = any || s
+			if a {
+				full = append(full, child)
+			}
+		}
+		if all || !any {
+			return all, any
+		}
+		for _, child := range full {
+			if child.nodeType() == "secret" {
+				add(child.path, withoutList(caps))
+			} else {
+				add(child.path+"/*", caps)
+			}
+		}
+		if selected(n) {
+			if n.nodeType() == "secret" {
+				add(n.path, withoutList(caps))
+			} else {
+				add(n.aclPath(), caps)
+			}
+		}
+		if n.nodeType() != "secret" {
+			add(n.aclPath(), []string{"list"})
+		}
+		return false, true
+	}
+	if all, _ := walk(root); all {
+		add(root.path+"/*", caps)
+	}
+
+	var out []hclRule
+	for p, c := range rules {
+		out = append(out, hclRule{p, c})
+	}
+	sort.Sort(byRulePath(out))
+	return out
+}
+
+type byRulePath []hclRule
+
+func (b byRulePath) Len() int           { return len(b) }
+func (b byRulePath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byRulePath) Less(i, j int) bool { return b[i].path < b[j].path }
+
+// selfPolicy returns the rules vaultVisualize needs for the crawl and for
+// whatever the other flags given ask it to read.
+func selfPolicy() []hclRule {
+	var out []hclRule
+	for _, r := range crawlRoots {
+		out = append(out, hclRule{r + "/*", []string{"list"}})
+	}
+	out = append(out, hclRule{"sys/mounts", []string{"read"}})
+	if policyOverlay {
+		out = append(out, hclRule{"sys/policy", []string{"read"}}, hclRule{"sys/policy/*", []string{"read"}})
+	}
+	switch {
+	case asAccessor != "":
+		out = append(out, hclRule{"sys/capabilities-accessor", []string{"update"}})
+	case asToken != "":
+		out = append(out, hclRule{"sys/capabilities", []string{"update"}}, hclRule{"sys/capabilities-self", []string{"update"}})
+	}
+	return out
+}
+
+// hclOut writes the rules as policy HCL under a comment.
+func hclOut(w io.Writer, comment string, rules []hclRule) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n", comment)
+	for _, r := range rules {
+		fmt.Fprintf(&b, "\npath %q {\n  capabilities = [\"%s\"]\n}\n", r.path, strings.Join(r.caps, `", "`))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// policyGenerateCmd represents the policy generate command
+var policyGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Write the least privileged policy for a selection of paths",
+	Long: `Write the policy HCL granting --capabilities on every crawled path matching a --path glob, with list on the
+folders leading to them, using a single glob rule for folders selected in full. ** in a --path matches any number of
+path segments. --for-self instead writes the policy vaultVisualize needs to crawl, and to do whatever the other flags
+given ask of it.`,
+	Run: func(generate *cobra.Command, args []string) {
+		var err error
+		if forSelf {
+			err = hclOut(os.Stdout, "Policy for vaultVisualize, sys/mounts is only read for the engine version", selfPolicy())
+		} else {
+			caps := strings.Split(generateCaps, ",")
+			for _, c := range caps {
+				if capabilityRank(c) < 0 || c == "deny" {
+					err = fmt.Errorf("unknown capability %q", c)
+				}
+			}
+			if err == nil && len(generatePaths) == 0 {
+				err = fmt.Errorf("policy generate needs a --path or --for-self")
+			}
+			if err == nil {
+				rules := generatePolicy(loadTree(), generatePaths, caps)
+				if len(rules) == 0 {
+					err = fmt.Errorf("no crawled path matches %s", strings.Join(generatePaths, ", "))
+				} else {
+					err = hclOut(os.Stdout, "Generated by vaultVisualize for "+strings.Join(generatePaths, ", "), rules)
+				}
+			}
+		}
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"error":   err,
+			}).Error(`Could not generate the policy`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"error":   err,
+			}).Error(`Could not generate the policy`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	policyCmd.AddCommand(policyGenerateCmd)
+	policyGenerateCmd.Flags().StringSliceVar(&generatePaths, "path", nil, "glob selecting the paths to grant access to, may be repeated")
+	policyGenerateCmd.Flags().StringVar(&generateCaps, "capabilities", "read,list", "comma separated capabilities granted on the selected paths")
+	policyGenerateCmd.Flags().BoolVar(&forSelf, "for-self", false, "write the policy vaultVisualize itself needs instead")
+}
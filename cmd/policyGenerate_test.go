@@ -0,0 +1,95 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSelectMatch(t *testing.T) {
+
+	Convey("Double stars should match any number of segments", t, func() {
+		So(selectMatch("secret/app1/**", "secret/app1"), should.BeTrue)
+		So(selectMatch("secret/app1/**", "secret/app1/a/b/c"), should.BeTrue)
+		So(selectMatch("secret/**/db", "secret/x/y/db"), should.BeTrue)
+		So(selectMatch("secret/app1/*", "secret/app1/a/b"), should.BeFalse)
+		So(selectMatch("secret/app*/db", "secret/app2/db"), should.BeTrue)
+	})
+}
+
+func TestGeneratePolicy(t *testing.T) {
+
+	root := buildTree("secret/app1/", "secret/app1/db", "secret/app1/conf/", "secret/app1/conf/a", "secret/app1/conf/b",
+		"secret/app2/", "secret/app2/db", "secret/top")
+
+	Convey("When a whole subtree is selected", t, func() {
+		rules := generatePolicy(root, []string{"secret/app1/**"}, []string{"read", "list"})
+
+		Convey("It should be granted with one glob rule and list on the folders above", func() {
+			So(rules, should.Resemble, []hclRule{
+				{"secret/", []string{"list"}},
+				{"secret/app1/*", []string{"read", "list"}},
+			})
+		})
+	})
+
+	Convey("When part of a subtree is selected", t, func() {
+		rules := generatePolicy(root, []string{"secret/*/db", "secret/app1/conf/a"}, []string{"read", "list"})
+
+		Convey("Secrets should get exact rules without list", func() {
+			So(rules, should.Resemble, []hclRule{
+				{"secret/", []string{"list"}},
+				{"secret/app1/", []string{"list"}},
+				{"secret/app1/conf/", []string{"list"}},
+				{"secret/app1/conf/a", []string{"read"}},
+				{"secret/app1/db", []string{"read"}},
+				{"secret/app2/", []string{"list"}},
+				{"secret/app2/db", []string{"read"}},
+			})
+		})
+	})
+
+	Convey("When everything is selected", t, func() {
+		rules := generatePolicy(root, []string{"secret/**"}, []string{"read"})
+		So(rules, should.Resemble, []hclRule{{"secret/*", []string{"read"}}})
+	})
+
+	Convey("The HCL written should parse back to the same rules", t, func() {
+		var b bytes.Buffer
+		rules := generatePolicy(root, []string{"secret/*/db"}, []string{"read", "update"})
+		So(hclOut(&b, "test", rules), should.BeNil)
+		p, err := parsePolicy("gen", b.String())
+		So(err, should.BeNil)
+		So(p.Rules, should.HaveLength, len(rules))
+		r, _ := p.match("secret/app2/db")
+		So(r.Capabilities, should.Resemble, []string{"read", "update"})
+	})
+
+	Convey("The policy for vaultVisualize should follow the flags given", t, func() {
+		So(selfPolicy()[0], should.Resemble, hclRule{"secret/*", []string{"list"}})
+		policyOverlay = true
+		defer func() { policyOverlay = false }()
+		So(selfPolicy(), should.Contain, hclRule{"sys/policy/*", []string{"read"}})
+	})
+}
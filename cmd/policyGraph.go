@@ -0,0 +1,374 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	gph "github.com/awalterschulze/gographviz"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var overlapFormat string // Output format of the policy overlap analysis
+
+// ruleCapabilities returns the capabilities of the rule the policy applies
+// to path, deny included, or nothing when no rule matches.
+func ruleCapabilities(p *aclPolicy, path string) []string {
+	r, ok := p.match(path)
+	if !ok {
+		return nil
+	}
+	return r.Capabilities
+}
+
+// reach is the top of a subtree a policy applies to.
+type reach struct {
+	node *secret
+	caps []string
+}
+
+// policyReach returns the nodes where the policy grants something different
+// than on their parent, the tops of the subtrees it applies to.
+func policyReach(p *aclPolicy, nodes []*secret) []reach {
+	var out []reach
+	for _, n := range nodes {
+		caps := ruleCapabilities(p, n.aclPath())
+		if len(caps) == 0 {
+			continue
+		}
+		if n.parent != nil && strings.Join(caps, ",") == strings.Join(ruleCapabilities(p, n.parent.aclPath()), ",") {
+			continue
+		}
+		out = append(out, reach{n, caps})
+	}
+	return out
+}
+
+// reachOut adds an edge from the node from to every subtree the policy
+// reaches, labelled by the capabilities granted and dashed when denied, adding
+// the path nodes to sub as needed.
+func reachOut(g *gph.Graph, sub, from, color string, p *aclPolicy, nodes []*secret) {
+	for _, r := range policyReach(p, nodes) {
+		pid := dotQuote(r.node.path)
+		if !g.IsNode(pid) {
+			shape := "note"
+			if r.node.nodeType() != "secret" {
+				shape = "folder"
+			}
+			g.AddNode(sub, pid, map[string]string{"label": dotQuote(r.node.aclPath()), "shape": shape})
+		}
+		attrs := map[string]string{"label": dotQuote(strings.Join(r.caps, ",")), "color": color}
+		if r.caps[0] == "deny" {
+			attrs["style"] = "dashed"
+		}
+		g.AddEdge(from, pid, true, attrs)
+	}
+}
+
+// policyGraphOut draws the policies on one side and the tops of the subtrees
+// they apply to on the other, with an edge labelled by the capabilities
+// granted.
+func policyGraphOut(w io.Writer, root *secret, v view) error {
+	if len(crawler.policies) == 0 {
+		return fmt.Errorf("the policy-graph format needs --policies or a snapshot written with them")
+	}
+	g := gph.NewGraph()
+	g.SetDir(true)
+	g.SetName("Policies")
+	g.AddAttr("Policies", "rankdir", "LR")
+	g.AddSubGraph("Policies", "cluster_policies", map[string]string{"label": dotQuote("Policies"), "style": dotQuote("dashed")})
+	g.AddSubGraph("Policies", "cluster_paths", map[string]string{"label": dotQuote(root.mount()), "style": dotQuote("dashed")})
+
+	nodes := v.nodes(root)
+	for i, p := range crawler.policies {
+		id := dotQuote("policy:" + p.Name)
+		color := colorPick(i)
+		g.AddNode("cluster_policies", id, map[string]string{"label": dotQuote(p.Name), "shape": "box", "color": color})
+		reachOut(g, "cluster_paths", id, color, p, nodes)
+	}
+	_, err := fmt.Fprintln(w, g.String())
+	return err
+}
+
+// subsetPair notes that everything a policy grants on the keyspace another
+// one grants as well, and more.
+type subsetPair struct {
+	Policy string `json:"policy"`
+	Of     string `json:"of"`
+}
+
+// denyConflict is a rule denying paths that a rule of another policy grants
+// capabilities on, and that wins over it once the policies are merged.
+type denyConflict struct {
+	Deny    policyRuleRef `json:"deny"`
+	Allow   policyRuleRef `json:"allow"`
+	Paths   int           `json:"paths"`
+	Example string        `json:"example"`
+	Allowed []string      `json:"allowed"`
+}
+
+// capabilityClash is two rules of different policies written for the same
+// path but granting different capabilities, which vault merges into one.
+type capabilityClash struct {
+	Rules   [2]policyRuleRef `json:"rules"`
+	Paths   int              `json:"paths"`
+	Example string           `json:"example"`
+}
+
+// redundantRule is a rule that changes nothing on the keyspace: wherever
+// vault applies it, the next rule of the same policy grants the same.
+type redundantRule struct {
+	policyRuleRef
+	Because string `json:"because"` // rule granting the same, empty when it is always shadowed
+}
+
+// overlapReport is the result of the policy overlap analysis.
+type overlapReport struct {
+	Subsets   []subsetPair      `json:"subsets"`
+	Conflicts []denyConflict    `json:"conflicts"`
+	Clashes   []capabilityClash `json:"clashes"`
+	Redundant []redundantRule   `json:"redundant"`
+}
+
+// capsSubset reports whether every capability in a is also in b.
+func capsSubset(a, b []string) bool {
+	return len(capabilityDiff(a, b)) == 0
+}
+
+// analyzeOverlap compares the policies on every path below root.
+func analyzeOverlap(root *secret, policies []*aclPolicy) overlapReport {
+	rep := overlapReport{Subsets: []subsetPair{}, Conflicts: []denyConflict{}, Clashes: []capabilityClash{}, Redundant: []redundantRule{}}
+	var nodes []string
+	var walk func(n *secret)
+	walk = func(n *secret) {
+		nodes = append(nodes, n.aclPath())
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	// granted[i][j] is what policy i grants on node j, deny as nothing.
+	granted := make([][]string, len(policies))
+	applied := make([][]policyRule, len(policies))
+	for i, p := range policies {
+		granted[i] = make([]string, len(nodes))
+		applied[i] = make([]policyRule, len(nodes))
+		for j, path := range nodes {
+			rules := p.matching(path)
+			if len(rules) == 0 {
+				continue
+			}
+			applied[i][j] = rules[0]
+			if rules[0].Capabilities[0] != "deny" {
+				granted[i][j] = strings.Join(rules[0].Capabilities, ",")
+			}
+		}
+	}
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, ",")
+	}
+
+	for a := range policies {
+		for b := range policies {
+			if a == b {
+				continue
+			}
+			subset, some, more := true, false, false
+			for j := range nodes {
+				ca, cb := split(granted[a][j]), split(granted[b][j])
+				if !capsSubset(ca, cb) {
+					subset = false
+					break
+				}
+				some = some || len(ca) > 0
+				more = more || len(cb) > len(ca)
+			}
+			if subset && some && more {
+				rep.Subsets = append(rep.Subsets, subsetPair{policies[a].Name, policies[b].Name})
+			}
+		}
+	}
+
+	// Merged into one ACL the rule written for the more specific path wins, so
+	// only a deny that wins over a grant, or rules of the same priority
+	// granting different capabilities, are conflicts.
+	conflicts := map[[2]policyRuleRef]int{}
+	clashes := map[[2]policyRuleRef]int{}
+	for a, p := range policies {
+		for j, path := range nodes {
+			r := applied[a][j]
+			if r.Path == "" {
+				continue
+			}
+			for b, o := range policies {
+				q := applied[b][j]
+				if a == b || q.Path == "" || q.Capabilities[0] == "deny" {
+					continue
+				}
+				best := policyGrants([]*aclPolicy{p, o}, path)[0].Rule
+				if !r.samePath(best) {
+					continue
+				}
+				key := [2]policyRuleRef{{p.Name, r.Path}, {o.Name, q.Path}}
+				switch {
+				case r.Capabilities[0] == "deny":
+					i, ok := conflicts[key]
+					if !ok {
+						i = len(rep.Conflicts)
+						conflicts[key] = i
+						rep.Conflicts = append(rep.Conflicts, denyConflict{Deny: key[0], Allow: key[1], Example: path, Allowed: q.Capabilities})
+					}
+					rep.Conflicts[i].Paths++
+				case a < b && q.samePath(best) && strings.Join(sortCapabilities(r.Capabilities), ",") != strings.Join(sortCapabilities(q.Capabilities), ","):
+					i, ok := clashes[key]
+					if !ok {
+						i = len(rep.Clashes)
+						clashes[key] = i
+						rep.Clashes = append(rep.Clashes, capabilityClash{Rules: key, Example: path})
+					}
+					rep.Clashes[i].Paths++
+				}
+			}
+		}
+	}
+
+	for _, p := range policies {
+		for _, r := range p.Rules {
+			matched, needed, because := false, false, ""
+			for _, path := range nodes {
+				rules := p.matching(path)
+				for k, m := range rules {
+					if m.Path != r.Path {
+						continue
+					}
+					matched = true
+					if k > 0 {
+						break
+					}
+					if len(rules) == 1 || strings.Join(rules[1].Capabilities, ",") != strings.Join(r.Capabilities, ",") {
+						needed = true
+					} else {
+						because = rules[1].Path
+					}
+				}
+				if needed {
+					break
+				}
+			}
+			if matched && !needed {
+				rep.Redundant = append(rep.Redundant, redundantRule{policyRuleRef{p.Name, r.Path}, because})
+			}
+		}
+	}
+	return rep
+}
+
+// overlapText writes the analysis as aligned plain text.
+func overlapText(w io.Writer, rep overlapReport) error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Policies granting a strict subset of another (%d)\n", len(rep.Subsets))
+	for _, s := range rep.Subsets {
+		fmt.Fprintf(tw, "%s\tis a subset of %s\n", s.Policy, s.Of)
+	}
+	fmt.Fprintf(tw, "\nDeny rules overriding another policy (%d)\n", len(rep.Conflicts))
+	for _, c := range rep.Conflicts {
+		fmt.Fprintf(tw, "%s %s\tdenies %s from %s %s\ton %d paths, e.g. %s\n", c.Deny.Policy, c.Deny.Rule,
+			strings.Join(c.Allowed, ","), c.Allow.Policy, c.Allow.Rule, c.Paths, c.Example)
+	}
+	fmt.Fprintf(tw, "\nRules for the same path granting different capabilities (%d)\n", len(rep.Clashes))
+	for _, c := range rep.Clashes {
+		fmt.Fprintf(tw, "%s %s\tand %s %s\ton %d paths, e.g. %s\n", c.Rules[0].Policy, c.Rules[0].Rule,
+			c.Rules[1].Policy, c.Rules[1].Rule, c.Paths, c.Example)
+	}
+	fmt.Fprintf(tw, "\nRedundant rules (%d)\n", len(rep.Redundant))
+	for _, r := range rep.Redundant {
+		why := "always shadowed by a more specific rule"
+		if r.Because != "" {
+			why = "grants the same as " + r.Because
+		}
+		fmt.Fprintf(tw, "%s %s\t%s\n", r.Policy, r.Rule, why)
+	}
+	tw.Flush()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeOverlap writes the analysis in the given format, text or json.
+func writeOverlap(w io.Writer, rep overlapReport, f string) error {
+	switch f {
+	case "text":
+		return overlapText(w, rep)
+	case "json":
+		out, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	return fmt.Errorf("unknown overlap format %q", f)
+}
+
+// policyOverlapCmd represents the policy overlap command
+var policyOverlapCmd = &cobra.Command{
+	Use:   "overlap",
+	Short: "Find subset policies, deny conflicts and redundant rules",
+	Long: `Compare what the policies grant on every path of the keyspace, live or from a --snapshot, and report the
+policies granting a strict subset of another, the deny rules taking away what another policy grants on the same
+paths, and the rules that change nothing because a rule of the same policy grants the same. Draw the policies and
+the paths they reach with --format policy-graph.`,
+	Run: func(overlap *cobra.Command, args []string) {
+		rep := analyzeOverlap(loadTree(), keyspacePolicies())
+		if err := writeOverlap(os.Stdout, rep, overlapFormat); err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  overlapFormat,
+				"error":   err,
+			}).Error(`Could not write the overlap analysis`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  overlapFormat,
+				"error":   err,
+			}).Error(`Could not write the overlap analysis`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	policyCmd.AddCommand(policyOverlapCmd)
+	policyOverlapCmd.Flags().StringVar(&overlapFormat, "format", "text", "report format (text, json)")
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestPolicyGraphOut(t *testing.T) {
+
+	Convey("When drawing the policies against the keyspace", t, func() {
+		app, _ := parsePolicy("app", `
+path "secret/app/*" { capabilities = ["read", "list"] }
+path "secret/app/admin" { capabilities = ["deny"] }
+`)
+		crawler.policies = []*aclPolicy{app}
+		defer func() { crawler.policies = nil }()
+		root := buildTree("secret/app/", "secret/app/db", "secret/app/admin", "secret/top")
+		var b bytes.Buffer
+		So(policyGraphOut(&b, root, view{}), should.BeNil)
+
+		Convey("Policies should link to the top of the subtrees they grant, labelled by capability", func() {
+			So(b.String(), should.ContainSubstring, "\"policy:app\"->\"secret/app\"[ color=\"red\", label=\"read,list\" ]")
+			So(b.String(), should.NotContainSubstring, "\"policy:app\"->\"secret/app/db\"")
+		})
+		Convey("Denied paths should get a dashed edge", func() {
+			So(b.String(), should.ContainSubstring, "\"policy:app\"->\"secret/app/admin\"[ color=\"red\", label=\"deny\", style=dashed ]")
+		})
+	})
+
+	Convey("Without policies the graph should not be drawn", t, func() {
+		var b bytes.Buffer
+		So(policyGraphOut(&b, testTree(), view{}), should.NotBeNil)
+	})
+}
+
+func TestAnalyzeOverlap(t *testing.T) {
+
+	Convey("When analysing overlapping policies", t, func() {
+		root := buildTree("secret/app/", "secret/app/db", "secret/app/api", "secret/ops/", "secret/ops/key")
+		wide, _ := parsePolicy("wide", `path "secret/*" { capabilities = ["read", "list"] }`)
+		narrow, _ := parsePolicy("narrow", `
+path "secret/app/*" { capabilities = ["read"] }
+path "secret/app/db" { capabilities = ["read"] }
+path "secret/app/a*" { capabilities = ["list"] }
+`)
+		deny, _ := parsePolicy("deny", `path "secret/ops/*" { capabilities = ["deny"] }`)
+		rep := analyzeOverlap(root, []*aclPolicy{wide, narrow, deny})
+
+		Convey("A policy granting less than another on every path should be a subset", func() {
+			So(rep.Subsets, should.Resemble, []subsetPair{{"narrow", "wide"}})
+		})
+		Convey("Deny rules overriding another policy should be grouped per rule pair", func() {
+			So(rep.Conflicts, should.HaveLength, 1)
+			So(rep.Conflicts[0].Deny, should.Resemble, policyRuleRef{"deny", "secret/ops/*"})
+			So(rep.Conflicts[0].Allow, should.Resemble, policyRuleRef{"wide", "secret/*"})
+			So(rep.Conflicts[0].Paths, should.Equal, 2)
+			So(rep.Conflicts[0].Allowed, should.Resemble, []string{"read", "list"})
+		})
+		Convey("Rules granting the same as the next matching rule should be redundant", func() {
+			So(rep.Redundant, should.Resemble, []redundantRule{{policyRuleRef{"narrow", "secret/app/db"}, "secret/app/*"}})
+		})
+	})
+
+	Convey("When policies are merged the more specific rule should decide", t, func() {
+		root := buildTree("secret/app/", "secret/app/db")
+		lock, _ := parsePolicy("lock", `path "secret/app/*" { capabilities = ["deny"] }`)
+		db, _ := parsePolicy("db", `path "secret/app/db" { capabilities = ["read"] }`)
+		ops, _ := parsePolicy("ops", `path "secret/app/db" { capabilities = ["update"] }`)
+		rep := analyzeOverlap(root, []*aclPolicy{lock, db, ops})
+
+		Convey("A deny shadowed by a more specific grant should not be a conflict", func() {
+			So(rep.Conflicts, should.BeEmpty)
+		})
+		Convey("Rules for the same path granting different capabilities should be reported", func() {
+			So(rep.Clashes, should.Resemble, []capabilityClash{{[2]policyRuleRef{{"db", "secret/app/db"}, {"ops", "secret/app/db"}}, 1, "secret/app/db"}})
+		})
+	})
+}
@@ -0,0 +1,161 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+const testPolicy = `
+path "secret/app/*" {
+  capabilities = ["read", "list"]
+}
+
+path "secret/app/+/db" {
+  capabilities = ["update", "read"]
+}
+
+path "secret/app/admin" {
+  capabilities = ["deny"]
+}
+
+path "secret/legacy" {
+  policy = "write"
+}
+`
+
+func TestParsePolicy(t *testing.T) {
+
+	Convey("When parsing a policy", t, func() {
+		p, err := parsePolicy("app", testPolicy)
+		So(err, should.BeNil)
+
+		Convey("Every path block should become a rule", func() {
+			So(p.Name, should.Equal, "app")
+			So(p.Rules, should.HaveLength, 4)
+			So(p.Rules[0].Path, should.Equal, "secret/app/*")
+		})
+		Convey("Capabilities should be sorted and old policy fields expanded", func() {
+			So(p.Rules[1].Capabilities, should.Resemble, []string{"read", "update"})
+			So(p.Rules[3].Capabilities, should.Resemble, []string{"create", "read", "update", "delete", "list"})
+		})
+	})
+
+	Convey("Unknown capabilities should be rejected", t, func() {
+		_, err := parsePolicy("bad", `path "secret/*" { capabilities = ["raed"] }`)
+		So(err, should.NotBeNil)
+	})
+
+	Convey("Policies should be parsed from json too", t, func() {
+		p, err := parsePolicy("json", `{"path": {"secret/*": {"capabilities": ["list"]}}}`)
+		So(err, should.BeNil)
+		So(p.Rules[0].Path, should.Equal, "secret/*")
+	})
+}
+
+func TestPolicyMatching(t *testing.T) {
+
+	Convey("When matching rule paths", t, func() {
+		So(newPolicyRule("secret/app", nil).matches("secret/app"), should.BeTrue)
+		So(newPolicyRule("secret/app", nil).matches("secret/app/"), should.BeFalse)
+		So(newPolicyRule("secret/app*", nil).matches("secret/apple/key"), should.BeTrue)
+		So(newPolicyRule("secret/+/db", nil).matches("secret/x/db"), should.BeTrue)
+		So(newPolicyRule("secret/+/db", nil).matches("secret/x/y/db"), should.BeFalse)
+		So(newPolicyRule("secret/+/db/*", nil).matches("secret/x/db/"), should.BeTrue)
+		So(newPolicyRule("/secret/*", nil).matches("secret/x"), should.BeTrue)
+	})
+
+	Convey("When several rules of a policy match, the most specific should apply", t, func() {
+		p, _ := parsePolicy("app", testPolicy)
+		r, ok := p.match("secret/app/web/db")
+		So(ok, should.BeTrue)
+		So(r.Path, should.Equal, "secret/app/+/db")
+		r, _ = p.match("secret/app/admin")
+		So(r.Capabilities, should.Resemble, []string{"deny"})
+		r, _ = p.match("secret/app/web/")
+		So(r.Path, should.Equal, "secret/app/*")
+		_, ok = p.match("secret/other")
+		So(ok, should.BeFalse)
+	})
+
+	Convey("When merging policies, the highest priority rule across all of them should apply", t, func() {
+		a, _ := parsePolicy("a", `path "secret/*" { capabilities = ["read"] }`)
+		b, _ := parsePolicy("b", `path "secret/x" { capabilities = ["list"] }`)
+		grants := policyGrants([]*aclPolicy{a, b}, "secret/x")
+		So(grants, should.HaveLength, 1)
+		So(grants[0].Policy, should.Equal, "b")
+		So(effectiveCapabilities(grants), should.Resemble, []string{"list"})
+		So(effectiveCapabilities(policyGrants([]*aclPolicy{a, b}, "secret/y")), should.Resemble, []string{"read"})
+	})
+
+	Convey("Rules for the same path in several policies should be merged", t, func() {
+		a, _ := parsePolicy("a", `path "secret/x" { capabilities = ["read"] }`)
+		b, _ := parsePolicy("b", `path "/secret/x" { capabilities = ["list"] }`)
+		d, _ := parsePolicy("d", `path "secret/x" { capabilities = ["deny"] }`)
+		So(effectiveCapabilities(policyGrants([]*aclPolicy{a, b}, "secret/x")), should.Resemble, []string{"read", "list"})
+		So(effectiveCapabilities(policyGrants([]*aclPolicy{a, b, d}, "secret/x")), should.Resemble, []string{"deny"})
+	})
+}
+
+func TestOverlayPolicies(t *testing.T) {
+
+	Convey("When overlaying policies on a keyspace", t, func() {
+		app, _ := parsePolicy("app", testPolicy)
+		ops, _ := parsePolicy("ops", `
+path "secret/*" { capabilities = ["list"] }
+path "secret/app/*" { capabilities = ["list"] }
+`)
+		root := buildTree("secret/app/", "secret/app/web/", "secret/app/web/db", "secret/app/admin", "secret/other")
+		overlayPolicies(root, []*aclPolicy{app, ops})
+
+		Convey("Folders should be matched with a trailing slash", func() {
+			So(secretAt(root, "secret/app").annotations["policies"], should.Equal, "app,ops")
+			So(secretAt(root, "secret/app").annotations["capabilities"], should.Equal, "read,list")
+		})
+		Convey("Secrets should carry the capabilities of the rule vault applies", func() {
+			So(secretAt(root, "secret/app/web/db").annotations["policies"], should.Equal, "app")
+			So(secretAt(root, "secret/app/web/db").annotations["capabilities"], should.Equal, "read,update")
+			So(secretAt(root, "secret/app/admin").annotations["capabilities"], should.Equal, "deny")
+			So(secretAt(root, "secret/other").annotations["policies"], should.Equal, "ops")
+		})
+		Convey("Graph edges should be coloured per policy", func() {
+			th, _ := loadTheme("plain")
+			So(th.edgeAttrs(secretAt(root, "secret/app")), should.Resemble, map[string]string{"color": "\"red:blue\""})
+			So(th.edgeAttrs(secretAt(root, "secret/app/admin"))["style"], should.Equal, "\"dashed\"")
+			So(th.legendEntries(), should.HaveLength, 2)
+		})
+	})
+}
+
+// secretAt returns the node at path below root.
+func secretAt(root *secret, path string) *secret {
+	if root.path == path {
+		return root
+	}
+	for _, child := range root.children {
+		if n := secretAt(child, path); n != nil {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/template"
+	"time"
+)
+
+var reportFormat string // Output format of the report
+var reportTop int       // Number of subtrees and paths listed in the report
+
+// mountSummary is one row of the per mount table in the report.
+type mountSummary struct {
+	Path          string
+	Engine        string
+	EngineVersion string
+	Folders       int
+	Secrets       int
+}
+
+// reportData is everything a report template can use.
+type reportData struct {
+	Title     string
+	Version   string
+	Generated time.Time
+	Root      *secret
+	Mounts    []mountSummary
+	Stats     keyspaceStats
+	Mermaid   string // the keyspace as a mermaid flowchart
+	SVG       string // the keyspace as an svg treemap
+	Errors    []crawlError
+	Paths     []string
+}
+
+// markdownReport is the built in layout of the markdown report.
+const markdownReport = `# {{.Title}}
+
+Generated {{.Generated.Format "2006-01-02 15:04 MST"}} by vaultVisualize {{.Version}}.
+
+## Summary
+
+| Mount | Engine | Folders | Secrets |
+| --- | --- | ---: | ---: |
+{{range .Mounts}}| {{md .Path}} | {{.Engine}} {{.EngineVersion}} | {{.Folders}} | {{.Secrets}} |
+{{end}}
+## Statistics
+
+| Depth | Folders | Secrets |
+| ---: | ---: | ---: |
+{{range .Stats.Depths}}| {{.Depth}} | {{.Folders}} | {{.Secrets}} |
+{{end}}
+At most {{.Stats.MaxFanOut}} and on average {{printf "%.1f" .Stats.MeanFanOut}} children per folder.
+
+| Largest subtree | Secrets |
+| --- | ---: |
+{{range .Stats.Largest}}| {{md .Path}} | {{.Value}} |
+{{end}}
+{{if .Stats.EmptyFolders}}Empty folders: {{range $i, $p := .Stats.EmptyFolders}}{{if $i}}, {{end}}{{md $p}}{{end}}.
+{{else}}There are no empty folders.
+{{end}}
+## Keyspace
+
+` + "```mermaid" + `
+{{.Mermaid}}` + "```" + `
+
+## Crawl errors
+
+{{if .Errors}}| Path | Error |
+| --- | --- |
+{{range .Errors}}| {{md .Path}} | {{md .Error}} |
+{{end}}{{else}}The crawl finished without errors.
+{{end}}
+## Appendix: all paths
+
+{{range .Paths}}- {{md .}}
+{{end}}`
+
+// htmlReport is the built in layout of the single file html report.
+const htmlReport = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{html .Title}}</title>
+<style>
+body{font-family:sans-serif;margin:2em}
+table{border-collapse:collapse;margin-bottom:1em}
+th,td{border:1px solid #ccc;padding:2px 8px;text-align:left}
+td.n{text-align:right}
+</style>
+</head>
+<body>
+<h1>{{html .Title}}</h1>
+<p>Generated {{.Generated.Format "2006-01-02 15:04 MST"}} by vaultVisualize {{html .Version}}.</p>
+<h2>Summary</h2>
+<table>
+<tr><th>Mount</th><th>Engine</th><th>Folders</th><th>Secrets</th></tr>
+{{range .Mounts}}<tr><td>{{html .Path}}</td><td>{{html .Engine}} {{html .EngineVersion}}</td><td class="n">{{.Folders}}</td><td class="n">{{.Secrets}}</td></tr>
+{{end}}</table>
+<h2>Statistics</h2>
+<table>
+<tr><th>Depth</th><th>Folders</th><th>Secrets</th></tr>
+{{range .Stats.Depths}}<tr><td class="n">{{.Depth}}</td><td class="n">{{.Folders}}</td><td class="n">{{.Secrets}}</td></tr>
+{{end}}</table>
+<p>At most {{.Stats.MaxFanOut}} and on average {{printf "%.1f" .Stats.MeanFanOut}} children per folder.</p>
+<table>
+<tr><th>Largest subtree</th><th>Secrets</th></tr>
+{{range .Stats.Largest}}<tr><td>{{html .Path}}</td><td class="n">{{.Value}}</td></tr>
+{{end}}</table>
+{{if .Stats.EmptyFolders}}<p>Empty folders: {{html (join ", " .Stats.EmptyFolders)}}.</p>
+{{else}}<p>There are no empty folders.</p>
+{{end}}<h2>Keyspace</h2>
+{{.SVG}}
+<h2>Crawl errors</h2>
+{{if .Errors}}<table>
+<tr><th>Path</th><th>Error</th></tr>
+{{range .Errors}}<tr><td>{{html .Path}}</td><td>{{html .Error}}</td></tr>
+{{end}}</table>
+{{else}}<p>The crawl finished without errors.</p>
+{{end}}<h2>Appendix: all paths</h2>
+<ul>
+{{range .Paths}}<li>{{html .}}</li>
+{{end}}</ul>
+</body>
+</html>
+`
+
+// newReportData gathers the data used by the report templates.
+func newReportData(root *secret, v view, top int) (reportData, error) {
+	st := computeStats(root, v, top)
+	d := reportData{
+		Title:     "Vault keyspace report for " + root.path,
+		Version:   version.AppVersion(),
+		Generated: time.Now().UTC(),
+		Root:      root,
+		Stats:     st,
+		Errors:    crawler.errors,
+	}
+	for _, m := range sortedKeys(st.Mounts) {
+		var node *secret
+		for _, n := range v.nodes(root) {
+			if n.path == m {
+				node = n
+				break
+			}
+		}
+		ms := mountSummary{Path: m, Folders: st.Mounts[m].Folders, Secrets: st.Mounts[m].Secrets}
+		if node != nil {
+			ms.Engine, ms.EngineVersion = node.engine, node.engineVersion
+		}
+		d.Mounts = append(d.Mounts, ms)
+	}
+	for _, n := range v.nodes(root)[1:] {
+		d.Paths = append(d.Paths, n.path)
+	}
+
+	var b bytes.Buffer
+	if err := render("mermaid", &b, root, v); err != nil {
+		return d, err
+	}
+	d.Mermaid = b.String()
+	b.Reset()
+	if err := treemapOut(&b, root, v); err != nil {
+		return d, err
+	}
+	d.SVG = b.String()
+	return d, nil
+}
+
+// writeReport executes the report template for the format, or the template
+// file given with --template, over the keyspace.
+func writeReport(w io.Writer, root *secret, v view, f string, layoutFile string, top int) error {
+	layout := ""
+	switch f {
+	case "markdown":
+		layout = markdownReport
+	case "html":
+		layout = htmlReport
+	default:
+		return fmt.Errorf("unknown report format %q", f)
+	}
+	if layoutFile != "" {
+		b, err := ioutil.ReadFile(layoutFile)
+		if err != nil {
+			return err
+		}
+		layout = string(b)
+	}
+	t, err := template.New("report").Funcs(templateFuncs).Parse(layout)
+	if err != nil {
+		return err
+	}
+	d, err := newReportData(root, v, top)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, d)
+}
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Write a markdown or html inventory report of the vault keyspace",
+	Long: `Build a report from a live crawl or a --snapshot with a summary table per mount, statistics, a drawing of the
+keyspace, any crawl errors and an appendix listing every path. The layout is a go text/template which can be
+replaced with --template.`,
+	Run: func(report *cobra.Command, args []string) {
+		if err := writeReport(os.Stdout, loadTree(), flagView(), reportFormat, templateFile, reportTop); err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":      "vaultVisualize",
+				"version":  version.AppVersion(),
+				"format":   reportFormat,
+				"template": templateFile,
+				"error":    err,
+			}).Error(`Could not write the report`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":      "vaultVisualize",
+				"version":  version.AppVersion(),
+				"format":   reportFormat,
+				"template": templateFile,
+				"error":    err,
+			}).Error(`Could not write the report`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().StringVar(&reportFormat, "format", "markdown", "report format (markdown, html)")
+	reportCmd.Flags().IntVar(&reportTop, "top", 10, "number of largest subtrees to list")
+}
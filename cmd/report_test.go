@@ -0,0 +1,73 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWriteReport(t *testing.T) {
+
+	Convey("When writing the markdown report of the test tree with a crawl error", t, func() {
+		crawler.errors = []crawlError{{"secret/locked", "permission denied"}}
+		var b bytes.Buffer
+		err := writeReport(&b, testTree(), view{}, "markdown", "", 10)
+		crawler.errors = nil
+
+		Convey("Every section should be present", func() {
+			So(err, should.BeNil)
+			So(b.String(), should.ContainSubstring, "| secret | ")
+			So(b.String(), should.ContainSubstring, "```mermaid\ngraph TD\n")
+			So(b.String(), should.ContainSubstring, "| secret/locked | permission denied |")
+			So(b.String(), should.ContainSubstring, "- secret/ops/db\n")
+		})
+	})
+
+	Convey("When writing the html report", t, func() {
+		var b bytes.Buffer
+		err := writeReport(&b, buildTree("secret/<b>/", "secret/<b>/x"), view{}, "html", "", 10)
+
+		Convey("The treemap should be embedded and paths escaped", func() {
+			So(err, should.BeNil)
+			So(b.String(), should.ContainSubstring, "<svg")
+			So(b.String(), should.ContainSubstring, "<li>secret/&lt;b&gt;/x</li>")
+		})
+	})
+
+	Convey("When a template file is given", t, func() {
+		f, _ := ioutil.TempFile("", "report")
+		defer os.Remove(f.Name())
+		f.WriteString("{{.Stats.Total.Secrets}} secrets in {{len .Paths}} paths: {{join \", \" .Paths}}")
+		f.Close()
+		var b bytes.Buffer
+		err := writeReport(&b, testTree(), view{}, "markdown", f.Name(), 10)
+
+		Convey("It should replace the built in layout", func() {
+			So(err, should.BeNil)
+			So(b.String(), should.StartWith, "3 secrets in 5 paths: secret/app-1, secret/app-1/db, ")
+		})
+	})
+}
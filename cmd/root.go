@@ -33,16 +33,33 @@ import (
 	"os"
 )
 
-var cfgFile string    // Configuration via Viper
-var host string       // Hostname for logging
-var debug bool        // debugging info
-var insecureMode bool // strict cert verification
-var token string      // Vault token
-var dc string         // Datacenter
-var port string       // Port to connect to
-var path string       // Path to the secret
-var tag string        // Consul tag
-var outFile string    // Output file
+var cfgFile string      // Configuration via Viper
+var host string         // Hostname for logging
+var debug bool          // debugging info
+var insecureMode bool   // strict cert verification
+var token string        // Vault token
+var dc string           // Datacenter
+var port string         // Port to connect to
+var path string         // Path to the secret
+var tag string          // Consul tag
+var outFile string      // Output file
+var format string       // Output format
+var maxDepth int        // Deepest level to render
+var filter string       // Path glob to render
+var color string        // Colour mode for the tree output
+var appendOut bool      // Append to the output file instead of replacing it
+var outputDir string    // Directory to write every output format to
+var themeName string    // Built in theme or theme file for the dot output
+var legend bool         // Draw a legend for the theme
+var cluster string      // Group the dot output into cluster subgraphs
+var collapseChains bool // Merge single child folder chains in the graphs
+var maxChildren int     // Summarise folders with more children in the graphs
+var showChildren int    // Children still drawn next to the summary node
+var paged string        // Write one file per mount or first level folder
+var linkExt string      // Extension the paged index links to
+var snapshot string     // Json snapshot to read instead of crawling vault
+var templateFile string // Go template for the template format and report
+var fillBy string       // Colour the treemap and sunburst by owner, mount or depth
 
 // Create logging instances.
 var syslogLog = logrus.New()
@@ -101,7 +118,34 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&path, "path", "secret", "path to the secret w/o the leading slash")
 	RootCmd.PersistentFlags().StringVar(&port, "port", "8200", "port to use")
 	RootCmd.PersistentFlags().StringVar(&outFile, "outputFile", "", "file to write keysapces to")
+	RootCmd.PersistentFlags().BoolVar(&appendOut, "append", false, "append to the output file instead of replacing it")
+	RootCmd.PersistentFlags().StringVar(&outputDir, "output-dir", "", "directory to write each of the comma separated formats to, with a manifest")
 	RootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "print debugging info (if any)")
+	RootCmd.PersistentFlags().StringVar(&snapshot, "snapshot", "", "read the keyspace from a file written with --format json instead of crawling vault")
+	RootCmd.PersistentFlags().StringVar(&format, "format", "dot", "comma separated output formats (dot, mermaid, mermaid-mindmap, plantuml, plantuml-mindmap, d2, graphml, gexf, cytoscape, tree, csv, tsv, ndjson, json, treemap, sunburst, template, prometheus, graphite, policy-graph)")
+	RootCmd.PersistentFlags().IntVar(&maxDepth, "depth", 0, "deepest level below the root to render (0 renders everything)")
+	RootCmd.PersistentFlags().StringVar(&filter, "filter", "", "only render paths matching this glob, plus their parents and children")
+	RootCmd.PersistentFlags().StringVar(&paged, "paged", "", "with --output-dir, write one file per mount or first level folder plus an index (mount, folder)")
+	RootCmd.PersistentFlags().StringVar(&linkExt, "link-ext", "", "extension the paged index links to, e.g. svg when the dot files are rendered (defaults to the format's own)")
+	RootCmd.PersistentFlags().StringVar(&themeName, "theme", "plain", "dot theme, either built in (plain, depth, mount, type, access) or a yaml theme file")
+	RootCmd.PersistentFlags().BoolVar(&legend, "legend", true, "draw a legend explaining the theme in the dot output")
+	RootCmd.PersistentFlags().StringVar(&cluster, "cluster", "none", "group the dot output in boxes per mount or per mount and first level folder (none, mount, folder)")
+	RootCmd.PersistentFlags().BoolVar(&collapseChains, "collapse-chains", false, "draw chains of folders holding a single folder as one node in the graphs")
+	RootCmd.PersistentFlags().IntVar(&maxChildren, "max-children", 0, "draw folders with more children than this as a single summary node in the graphs (0 disables)")
+	RootCmd.PersistentFlags().IntVar(&showChildren, "show-children", 0, "number of children still drawn next to a summary node")
+	RootCmd.PersistentFlags().StringVar(&templateFile, "template", "", "go text/template file executed by --format template, or replacing the report layout")
+	RootCmd.PersistentFlags().StringVar(&fillBy, "fill-by", "owner", "colour the treemap and sunburst areas by owner, mount or depth")
+	RootCmd.PersistentFlags().IntVar(&metricsDepth, "metrics-depth", 1, "deepest folder below each mount given its own counts in the prometheus and graphite output")
+	RootCmd.PersistentFlags().StringVar(&graphitePrefix, "graphite-prefix", "vault.keyspace", "prefix of every metric name in the graphite output")
+	RootCmd.PersistentFlags().IntVar(&retries, "retries", 0, "times a request failing with a server or connection error is retried")
+	RootCmd.PersistentFlags().BoolVar(&timings, "timings", false, "print request latency percentiles, the slowest requests and time per mount to stderr after crawling")
+	RootCmd.PersistentFlags().IntVar(&timingTop, "timings-top", 10, "number of slowest requests listed by --timings")
+	RootCmd.PersistentFlags().StringVar(&traceFile, "trace", "", "write every request made while crawling to this file as chrome trace events")
+	RootCmd.PersistentFlags().BoolVar(&policyOverlay, "policies", false, "annotate every path with the policies and capabilities that apply to it, and colour the graph edges by policy")
+	RootCmd.PersistentFlags().StringVar(&asToken, "as-token", "", "annotate every path with the capabilities this token has on it, see --theme access and --capability")
+	RootCmd.PersistentFlags().StringVar(&asAccessor, "as-accessor", "", "like --as-token, for the token with this accessor")
+	RootCmd.PersistentFlags().StringVar(&capFilter, "capability", "", "only render paths where the --as-token capabilities include this one, plus their parents")
+	RootCmd.PersistentFlags().StringVar(&color, "color", "auto", "colour the tree output by node type (auto, always, never)")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,108 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+)
+
+// graphFormats are the formats drawn from a simplified copy of the tree when
+// --collapse-chains or --max-children is set.
+var graphFormats = map[string]bool{
+	"dot":              true,
+	"mermaid":          true,
+	"mermaid-mindmap":  true,
+	"plantuml":         true,
+	"plantuml-mindmap": true,
+	"d2":               true,
+	"graphml":          true,
+	"gexf":             true,
+	"cytoscape":        true,
+}
+
+// simplifying reports whether any of the graph simplification flags are set.
+func simplifying() bool {
+	return collapseChains || maxChildren > 0
+}
+
+// simplify returns a copy of the visible tree below root with chains of
+// single child folders merged into one node and folders holding more than
+// --max-children children replaced by a summary node. The tree itself is left
+// untouched so the other outputs still see every key.
+func simplify(v view, root *secret) *secret {
+	return simplifyNode(v, root, nil)
+}
+
+// simplifyNode copies node below parent, following single child folder
+// chains when --collapse-chains is set.
+func simplifyNode(v view, node *secret, parent *secret) *secret {
+	label := node.label
+	if collapseChains && parent != nil {
+		label = node.name()
+		for node.folder {
+			children := v.children(node)
+			if len(children) != 1 || !children[0].folder {
+				break
+			}
+			node = children[0]
+			label += "/" + node.name()
+		}
+	}
+	n := &secret{
+		path:          node.path,
+		parent:        parent,
+		folder:        node.folder,
+		annotations:   node.annotations,
+		label:         label,
+		engine:        node.engine,
+		engineVersion: node.engineVersion,
+	}
+
+	children := v.children(node)
+	var hidden []*secret
+	if maxChildren > 0 && len(children) > maxChildren {
+		shown := showChildren
+		if shown > len(children) {
+			shown = len(children)
+		}
+		children, hidden = children[:shown], children[shown:]
+	}
+	for _, child := range children {
+		n.addChild(simplifyNode(v, child, n))
+	}
+	if len(hidden) > 0 {
+		leaves := 0
+		for _, child := range hidden {
+			leaves += child.leafCount()
+		}
+		label := fmt.Sprintf("%d secrets", leaves)
+		if len(children) > 0 {
+			label = fmt.Sprintf("%d more secrets", leaves)
+		}
+		n.addChild(&secret{
+			path:    node.path + "/...",
+			parent:  n,
+			label:   label,
+			summary: leaves,
+		})
+	}
+	return n
+}
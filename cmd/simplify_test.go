@@ -0,0 +1,77 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+
+	Convey("When collapsing single child folder chains", t, func() {
+		collapseChains, maxChildren = true, 0
+		root := buildTree("secret/a/", "secret/a/b/", "secret/a/b/c/", "secret/a/b/c/key", "secret/a/b/c/other", "secret/top")
+		s := simplify(view{}, root)
+		collapseChains = false
+
+		Convey("The chain should be drawn as one node labelled with the joined path", func() {
+			So(len(s.children), should.Equal, 2)
+			So(s.children[0].name(), should.Equal, "a/b/c")
+			So(s.children[0].path, should.Equal, "secret/a/b/c")
+			So(len(s.children[0].children), should.Equal, 2)
+		})
+		Convey("The tree itself should be left untouched", func() {
+			So(root.children[0].name(), should.Equal, "a")
+			So(len(root.children[0].children), should.Equal, 1)
+		})
+	})
+
+	Convey("When summarising folders with more than two children", t, func() {
+		maxChildren, showChildren = 2, 0
+		root := buildTree("secret/big/", "secret/big/1", "secret/big/2", "secret/big/3", "secret/small/", "secret/small/1")
+		s := simplify(view{}, root)
+
+		Convey("The oversized folder should hold a single summary node", func() {
+			big := s.children[0]
+			So(len(big.children), should.Equal, 1)
+			So(big.children[0].name(), should.Equal, "3 secrets")
+			So(big.children[0].nodeType(), should.Equal, "summary")
+			So(big.children[0].leafCount(), should.Equal, 3)
+		})
+		Convey("Smaller folders should be drawn in full", func() {
+			So(len(s.children[1].children), should.Equal, 1)
+		})
+
+		Convey("When asking for the first child to still be shown", func() {
+			showChildren = 1
+			big := simplify(view{}, root).children[0]
+
+			Convey("The first child should be drawn next to the summary of the rest", func() {
+				So(len(big.children), should.Equal, 2)
+				So(big.children[0].name(), should.Equal, "1")
+				So(big.children[1].name(), should.Equal, "2 more secrets")
+			})
+		})
+		maxChildren, showChildren = 0, 0
+	})
+}
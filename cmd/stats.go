@@ -0,0 +1,318 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var statsFormat string // Output format of the stats report
+var statsTop int       // Number of subtrees and paths listed in the report
+
+// countStats is the number of folders and secrets in part of the keyspace.
+type countStats struct {
+	Folders int `json:"folders"`
+	Secrets int `json:"secrets"`
+}
+
+// depthStats counts the keys found at a single depth.
+type depthStats struct {
+	Depth int `json:"depth"`
+	countStats
+}
+
+// fanOutBucket counts the folders whose number of children falls in a range.
+type fanOutBucket struct {
+	Children string `json:"children"`
+	Folders  int    `json:"folders"`
+	min, max int
+}
+
+// pathStat is a path with the number that ranked it in the report.
+type pathStat struct {
+	Path  string `json:"path"`
+	Value int    `json:"value"`
+}
+
+// keyspaceStats is everything reported by the stats command.
+type keyspaceStats struct {
+	Root         string                `json:"root"`
+	Total        countStats            `json:"total"`
+	Mounts       map[string]countStats `json:"mounts"`
+	Depths       []depthStats          `json:"depths"`
+	MaxFanOut    int                   `json:"max_fan_out"`
+	MeanFanOut   float64               `json:"mean_fan_out"`
+	FanOut       []fanOutBucket        `json:"fan_out"`
+	Largest      []pathStat            `json:"largest_subtrees"`
+	EmptyFolders []string              `json:"empty_folders"`
+	Deepest      []pathStat            `json:"deepest_paths"`
+}
+
+// fanOutBuckets are the ranges of children counted in the fan out
+// distribution.
+var fanOutBuckets = []fanOutBucket{
+	{Children: "0", min: 0, max: 0},
+	{Children: "1", min: 1, max: 1},
+	{Children: "2-5", min: 2, max: 5},
+	{Children: "6-10", min: 6, max: 10},
+	{Children: "11-50", min: 11, max: 50},
+	{Children: "51-100", min: 51, max: 100},
+	{Children: "101-500", min: 101, max: 500},
+	{Children: "501+", min: 501, max: -1},
+}
+
+type byValue []pathStat
+
+func (b byValue) Len() int      { return len(b) }
+func (b byValue) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byValue) Less(i, j int) bool {
+	if b[i].Value != b[j].Value {
+		return b[i].Value > b[j].Value
+	}
+	return b[i].Path < b[j].Path
+}
+
+// topN sorts the paths from the highest value down and keeps the first n.
+func topN(paths []pathStat, n int) []pathStat {
+	sort.Sort(byValue(paths))
+	if n > 0 && len(paths) > n {
+		paths = paths[:n]
+	}
+	return paths
+}
+
+// computeStats gathers the keyspace statistics for every visible node below
+// root, listing top entries in the rankings.
+func computeStats(root *secret, v view, top int) keyspaceStats {
+	st := keyspaceStats{
+		Root:         root.path,
+		Mounts:       map[string]countStats{},
+		FanOut:       append([]fanOutBucket{}, fanOutBuckets...),
+		EmptyFolders: []string{},
+	}
+	var largest, deepest []pathStat
+	folders, children := 0, 0
+	for _, node := range v.nodes(root) {
+		d := node.depth()
+		for len(st.Depths) <= d {
+			st.Depths = append(st.Depths, depthStats{Depth: len(st.Depths)})
+		}
+		m := st.Mounts[node.mount()]
+		if node.nodeType() == "secret" {
+			st.Total.Secrets++
+			st.Depths[d].Secrets++
+			m.Secrets++
+			deepest = append(deepest, pathStat{node.path, d})
+		} else {
+			if node.parent != nil {
+				st.Total.Folders++
+				st.Depths[d].Folders++
+				m.Folders++
+				largest = append(largest, pathStat{node.path, node.leafCount()})
+			}
+			n := len(node.children)
+			folders++
+			children += n
+			if n > st.MaxFanOut {
+				st.MaxFanOut = n
+			}
+			for i, b := range st.FanOut {
+				if n >= b.min && (b.max < 0 || n <= b.max) {
+					st.FanOut[i].Folders++
+				}
+			}
+			if n == 0 {
+				st.EmptyFolders = append(st.EmptyFolders, node.path)
+			}
+		}
+		st.Mounts[node.mount()] = m
+	}
+	if folders > 0 {
+		st.MeanFanOut = float64(children) / float64(folders)
+	}
+	st.Largest = topN(largest, top)
+	st.Deepest = topN(deepest, top)
+	return st
+}
+
+// statsText writes the report as aligned plain text.
+func statsText(w io.Writer, st keyspaceStats) error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Keyspace %s: %d folders, %d secrets\n", st.Root, st.Total.Folders, st.Total.Secrets)
+	fmt.Fprintln(tw, "\nMount\tFolders\tSecrets")
+	for _, m := range sortedKeys(st.Mounts) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", m, st.Mounts[m].Folders, st.Mounts[m].Secrets)
+	}
+	fmt.Fprintln(tw, "\nDepth\tFolders\tSecrets")
+	for _, d := range st.Depths {
+		fmt.Fprintf(tw, "%d\t%d\t%d\n", d.Depth, d.Folders, d.Secrets)
+	}
+	fmt.Fprintf(tw, "\nChildren per folder (max %d, mean %.1f)\tFolders\n", st.MaxFanOut, st.MeanFanOut)
+	for _, f := range st.FanOut {
+		fmt.Fprintf(tw, "%s\t%d\n", f.Children, f.Folders)
+	}
+	fmt.Fprintln(tw, "\nLargest subtree\tSecrets")
+	for _, p := range st.Largest {
+		fmt.Fprintf(tw, "%s\t%d\n", p.Path, p.Value)
+	}
+	fmt.Fprintln(tw, "\nDeepest path\tDepth")
+	for _, p := range st.Deepest {
+		fmt.Fprintf(tw, "%s\t%d\n", p.Path, p.Value)
+	}
+	fmt.Fprintf(tw, "\nEmpty folders (%d)\n", len(st.EmptyFolders))
+	for _, p := range st.EmptyFolders {
+		fmt.Fprintln(tw, p)
+	}
+	tw.Flush()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// statsMarkdown writes the report as markdown tables.
+func statsMarkdown(w io.Writer, st keyspaceStats) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Keyspace statistics for %s\n\n", st.Root)
+	fmt.Fprintf(&b, "%d folders, %d secrets.\n\n", st.Total.Folders, st.Total.Secrets)
+	b.WriteString("## Mounts\n\n| Mount | Folders | Secrets |\n| --- | ---: | ---: |\n")
+	for _, m := range sortedKeys(st.Mounts) {
+		fmt.Fprintf(&b, "| %s | %d | %d |\n", mdEscape(m), st.Mounts[m].Folders, st.Mounts[m].Secrets)
+	}
+	b.WriteString("\n## Depth\n\n| Depth | Folders | Secrets |\n| ---: | ---: | ---: |\n")
+	for _, d := range st.Depths {
+		fmt.Fprintf(&b, "| %d | %d | %d |\n", d.Depth, d.Folders, d.Secrets)
+	}
+	fmt.Fprintf(&b, "\n## Fan out\n\nAt most %d and on average %.1f children per folder.\n\n", st.MaxFanOut, st.MeanFanOut)
+	b.WriteString("| Children | Folders |\n| --- | ---: |\n")
+	for _, f := range st.FanOut {
+		fmt.Fprintf(&b, "| %s | %d |\n", f.Children, f.Folders)
+	}
+	b.WriteString("\n## Largest subtrees\n\n| Path | Secrets |\n| --- | ---: |\n")
+	for _, p := range st.Largest {
+		fmt.Fprintf(&b, "| %s | %d |\n", mdEscape(p.Path), p.Value)
+	}
+	b.WriteString("\n## Deepest paths\n\n| Path | Depth |\n| --- | ---: |\n")
+	for _, p := range st.Deepest {
+		fmt.Fprintf(&b, "| %s | %d |\n", mdEscape(p.Path), p.Value)
+	}
+	fmt.Fprintf(&b, "\n## Empty folders\n\n")
+	if len(st.EmptyFolders) == 0 {
+		b.WriteString("None.\n")
+	}
+	for _, p := range st.EmptyFolders {
+		fmt.Fprintf(&b, "- %s\n", mdEscape(p))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// checkStatsFormat fails on a format writeStats does not know, so that it can
+// be reported before the crawl.
+func checkStatsFormat(f string) error {
+	switch f {
+	case "text", "markdown", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown stats format %q", f)
+}
+
+// writeStats writes the report in the named format.
+func writeStats(w io.Writer, st keyspaceStats, f string) error {
+	if err := checkStatsFormat(f); err != nil {
+		return err
+	}
+	switch f {
+	case "text":
+		return statsText(w, st)
+	case "markdown":
+		return statsMarkdown(w, st)
+	case "json":
+		out, err := json.MarshalIndent(st, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of the mount counts in order.
+func sortedKeys(m map[string]countStats) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mdEscape keeps a value from breaking out of a markdown table cell.
+func mdEscape(s string) string {
+	return strings.Replace(strings.Replace(s, "|", "\\|", -1), "_", "\\_", -1)
+}
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Report statistics about the vault keyspace",
+	Long: `Count the folders and secrets per mount and depth, the fan out of folders, the largest subtrees, empty
+folders and the deepest paths, either from a live crawl or from a --snapshot.`,
+	Run: func(stats *cobra.Command, args []string) {
+		err := checkStatsFormat(statsFormat)
+		if err == nil {
+			st := computeStats(loadTree(), flagView(), statsTop)
+			err = writeStats(os.Stdout, st, statsFormat)
+		}
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  statsFormat,
+				"error":   err,
+			}).Error(`Could not write the stats report`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"format":  statsFormat,
+				"error":   err,
+			}).Error(`Could not write the stats report`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().StringVar(&statsFormat, "format", "text", "report format (text, json, markdown)")
+	statsCmd.Flags().IntVar(&statsTop, "top", 10, "number of largest subtrees and deepest paths to list")
+}
@@ -0,0 +1,84 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+
+	Convey("When computing the statistics of a keyspace with an empty folder", t, func() {
+		root := buildTree("secret/app/", "secret/app/db", "secret/app/deep/", "secret/app/deep/key", "secret/empty/", "secret/top")
+		st := computeStats(root, view{}, 2)
+
+		Convey("The totals should not count the mount as a folder", func() {
+			So(st.Total, should.Resemble, countStats{Folders: 3, Secrets: 3})
+			So(st.Mounts["secret"], should.Resemble, countStats{Folders: 3, Secrets: 3})
+		})
+		Convey("Keys should be counted per depth", func() {
+			So(len(st.Depths), should.Equal, 4)
+			So(st.Depths[1].countStats, should.Resemble, countStats{Folders: 2, Secrets: 1})
+		})
+		Convey("The fan out distribution should cover every folder", func() {
+			So(st.FanOut[0].Folders, should.Equal, 1)
+			So(st.FanOut[1].Folders, should.Equal, 1)
+			So(st.FanOut[2].Folders, should.Equal, 2)
+			So(st.MaxFanOut, should.Equal, 3)
+		})
+		Convey("The rankings should be cut to the top entries", func() {
+			So(st.Largest, should.Resemble, []pathStat{{"secret/app", 2}, {"secret/app/deep", 1}})
+			So(st.Deepest, should.Resemble, []pathStat{{"secret/app/deep/key", 3}, {"secret/app/db", 2}})
+		})
+		Convey("Empty folders should be listed", func() {
+			So(st.EmptyFolders, should.Resemble, []string{"secret/empty"})
+		})
+	})
+}
+
+func TestWriteStats(t *testing.T) {
+
+	Convey("When writing the statistics of the test tree as markdown", t, func() {
+		var b bytes.Buffer
+		err := writeStats(&b, computeStats(testTree(), view{}, 10), "markdown")
+
+		Convey("The report should hold a table per section", func() {
+			So(err, should.BeNil)
+			So(b.String(), should.ContainSubstring, "| secret | 2 | 3 |\n")
+			So(b.String(), should.ContainSubstring, "## Largest subtrees")
+		})
+	})
+
+	Convey("When the stats format is unknown", t, func() {
+		err := writeStats(&bytes.Buffer{}, computeStats(testTree(), view{}, 10), "xml")
+
+		Convey("An error should be returned", func() {
+			So(err, should.NotBeNil)
+		})
+		Convey("It should be caught without a crawl", func() {
+			So(checkStatsFormat("xml"), should.NotBeNil)
+			So(checkStatsFormat("markdown"), should.BeNil)
+		})
+	})
+}
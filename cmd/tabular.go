@@ -0,0 +1,111 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// record is one row of the tabular exports, describing a single node.
+type record struct {
+	Path          string            `json:"path"`
+	Parent        string            `json:"parent"`
+	Name          string            `json:"name"`
+	Depth         int               `json:"depth"`
+	Type          string            `json:"type"`
+	Mount         string            `json:"mount"`
+	Engine        string            `json:"engine"`
+	EngineVersion string            `json:"engine_version"`
+	Children      int               `json:"children"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// recordHeader is the header row of the csv and tsv exports, annotation
+// columns are appended after it.
+var recordHeader = []string{"path", "parent", "name", "depth", "type", "mount", "engine", "engine_version", "children"}
+
+// newRecord builds the row describing the node.
+func newRecord(node *secret) record {
+	r := record{
+		Path:          node.path,
+		Name:          node.name(),
+		Depth:         node.depth(),
+		Type:          node.nodeType(),
+		Mount:         node.mount(),
+		Engine:        node.mountNode().engine,
+		EngineVersion: node.mountNode().engineVersion,
+		Children:      len(node.children),
+		Annotations:   node.annotations,
+	}
+	if node.parent != nil {
+		r.Parent = node.parent.path
+	}
+	return r
+}
+
+// delimitedOut writes one row per node separated by comma, with a header
+// row naming the columns.
+func delimitedOut(w io.Writer, root *secret, v view, comma rune) error {
+	nodes := v.nodes(root)
+	names := annotationNames(nodes)
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(append(append([]string{}, recordHeader...), names...)); err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		r := newRecord(node)
+		row := []string{r.Path, r.Parent, r.Name, strconv.Itoa(r.Depth), r.Type, r.Mount, r.Engine, r.EngineVersion, strconv.Itoa(r.Children)}
+		for _, n := range names {
+			row = append(row, r.Annotations[n])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvOut writes one comma separated row per node.
+func csvOut(w io.Writer, root *secret, v view) error {
+	return delimitedOut(w, root, v, ',')
+}
+
+// tsvOut writes one tab separated row per node.
+func tsvOut(w io.Writer, root *secret, v view) error {
+	return delimitedOut(w, root, v, '\t')
+}
+
+// ndjsonOut writes one json object per node per line, for streaming into jq
+// or a log pipeline.
+func ndjsonOut(w io.Writer, root *secret, v view) error {
+	enc := json.NewEncoder(w)
+	for _, node := range v.nodes(root) {
+		if err := enc.Encode(newRecord(node)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestCsvOut(t *testing.T) {
+
+	Convey("When exporting the test tree as csv", t, func() {
+		root := testTree()
+		root.engine, root.engineVersion = "kv", "1"
+		root.children[0].annotations = map[string]string{"owner": "web"}
+		var b bytes.Buffer
+		csvOut(&b, root, view{})
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+		Convey("The header should name every column including annotations", func() {
+			So(lines[0], should.Equal, "path,parent,name,depth,type,mount,engine,engine_version,children,owner")
+		})
+		Convey("There should be one row per node", func() {
+			So(len(lines), should.Equal, 7)
+		})
+		Convey("Each row should describe its node", func() {
+			So(lines[1], should.Equal, "secret,,secret,0,mount,secret,kv,1,2,")
+			So(lines[2], should.Equal, "secret/app-1,secret,app-1,1,folder,secret,kv,1,2,web")
+			So(lines[3], should.Equal, "secret/app-1/db,secret/app-1,db,2,secret,secret,kv,1,0,")
+		})
+	})
+}
+
+func TestNdjsonOut(t *testing.T) {
+
+	Convey("When exporting the test tree as ndjson", t, func() {
+		var b bytes.Buffer
+		ndjsonOut(&b, testTree(), view{})
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		var r record
+		err := json.Unmarshal([]byte(lines[5]), &r)
+
+		Convey("Every line should be a json record", func() {
+			So(len(lines), should.Equal, 6)
+			So(err, should.BeNil)
+		})
+		Convey("The record should carry the node details", func() {
+			So(r.Path, should.Equal, "secret/ops/db")
+			So(r.Parent, should.Equal, "secret/ops")
+			So(r.Depth, should.Equal, 2)
+			So(r.Type, should.Equal, "secret")
+		})
+	})
+}
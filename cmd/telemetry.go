@@ -0,0 +1,279 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"github.com/yieldbot/vaultVisualize/version"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var retries int      // Times a failed request is retried
+var timings bool     // Print a timing summary after crawling
+var traceFile string // Chrome trace event file of every request
+var timingTop = 10   // Slowest requests listed in the timing summary
+var retryWait = 250 * time.Millisecond
+
+// requestTiming records a single request sent to vault while crawling.
+type requestTiming struct {
+	Op       string        `json:"op"` // LIST or READ
+	Path     string        `json:"path"`
+	Status   int           `json:"status"` // 0 when no response was received
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Retries  int           `json:"retries"`
+}
+
+// mountTiming totals the requests sent below a single mount.
+type mountTiming struct {
+	Mount    string
+	Requests int
+	Total    time.Duration
+}
+
+// timingSummary describes how the time of a crawl was spent.
+type timingSummary struct {
+	Requests  int
+	Errors    int
+	Retries   int
+	Elapsed   time.Duration
+	PerSecond float64
+	P50       time.Duration
+	P95       time.Duration
+	P99       time.Duration
+	Slowest   []requestTiming
+	Mounts    []mountTiming
+}
+
+// vaultRequest sends a LIST or READ for path, retrying transport and server
+// errors up to --retries times, and records how long it took. A LIST of a
+// path holding no keys answers 404, which is not an error.
+func vaultRequest(cli *api.Client, op, path string) (*api.Response, error) {
+	t := requestTiming{Op: op, Path: path, Start: time.Now()}
+	var resp *api.Response
+	var err error
+	for {
+		r := cli.NewRequest("GET", "/v1/"+path)
+		if op == "LIST" {
+			r.Params.Set("list", "true")
+		}
+		resp, err = cli.RawRequest(r)
+		if err == nil || t.Retries >= retries || (resp != nil && resp.StatusCode < 500) {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		t.Retries++
+		time.Sleep(time.Duration(t.Retries) * retryWait)
+	}
+	if resp != nil {
+		t.Status = resp.StatusCode
+	}
+	if op == "LIST" {
+		crawler.requests++
+	}
+	t.Duration = time.Since(t.Start)
+	crawler.timings = append(crawler.timings, t)
+	if resp != nil && resp.StatusCode == 404 {
+		return resp, nil
+	}
+	return resp, err
+}
+
+// listKeys lists path the way Logical().List does, recording the request.
+// The secret is nil when path holds no keys.
+func listKeys(cli *api.Client, path string) (*api.Secret, error) {
+	resp, err := vaultRequest(cli, "LIST", path)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil || resp.StatusCode == 404 {
+		return nil, err
+	}
+	return api.ParseSecret(resp.Body)
+}
+
+// percentile returns the duration below which p percent of the sorted
+// durations fall.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+type byDuration []time.Duration
+
+func (b byDuration) Len() int           { return len(b) }
+func (b byDuration) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byDuration) Less(i, j int) bool { return b[i] < b[j] }
+
+type bySlowest []requestTiming
+
+func (b bySlowest) Len() int           { return len(b) }
+func (b bySlowest) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b bySlowest) Less(i, j int) bool { return b[i].Duration > b[j].Duration }
+
+// summarizeTimings works out the latency distribution, the slowest requests
+// and the time spent per mount from the recorded requests.
+func summarizeTimings(reqs []requestTiming, elapsed time.Duration, top int) timingSummary {
+	s := timingSummary{Requests: len(reqs), Elapsed: elapsed}
+	durations := make([]time.Duration, 0, len(reqs))
+	mounts := map[string]*mountTiming{}
+	var order []string
+	for _, r := range reqs {
+		durations = append(durations, r.Duration)
+		s.Retries += r.Retries
+		if r.Status == 0 || (r.Status >= 400 && r.Status != 404) {
+			s.Errors++
+		}
+		m := strings.SplitN(r.Path, "/", 2)[0]
+		if mounts[m] == nil {
+			mounts[m] = &mountTiming{Mount: m}
+			order = append(order, m)
+		}
+		mounts[m].Requests++
+		mounts[m].Total += r.Duration
+	}
+	sort.Sort(byDuration(durations))
+	s.P50 = percentile(durations, 50)
+	s.P95 = percentile(durations, 95)
+	s.P99 = percentile(durations, 99)
+	if elapsed > 0 {
+		s.PerSecond = float64(len(reqs)) / elapsed.Seconds()
+	}
+	s.Slowest = append([]requestTiming{}, reqs...)
+	sort.Stable(bySlowest(s.Slowest))
+	if top > 0 && len(s.Slowest) > top {
+		s.Slowest = s.Slowest[:top]
+	}
+	sort.Strings(order)
+	for _, m := range order {
+		s.Mounts = append(s.Mounts, *mounts[m])
+	}
+	return s
+}
+
+// timingText writes the summary as aligned plain text.
+func timingText(w io.Writer, s timingSummary) error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d requests in %s (%.1f/s), %d failed, %d retries\n", s.Requests, s.Elapsed, s.PerSecond, s.Errors, s.Retries)
+	fmt.Fprintf(tw, "Latency p50 %s, p95 %s, p99 %s\n", s.P50, s.P95, s.P99)
+	fmt.Fprintln(tw, "\nMount\tRequests\tTime")
+	for _, m := range s.Mounts {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", m.Mount, m.Requests, m.Total)
+	}
+	fmt.Fprintln(tw, "\nSlowest request\tStatus\tRetries\tTime")
+	for _, r := range s.Slowest {
+		fmt.Fprintf(tw, "%s %s\t%d\t%d\t%s\n", r.Op, r.Path, r.Status, r.Retries, r.Duration)
+	}
+	tw.Flush()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// traceEvent is a complete event in the chrome trace event format.
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat"`
+	Ph   string                 `json:"ph"`
+	Ts   int64                  `json:"ts"`  // microseconds since the crawl started
+	Dur  int64                  `json:"dur"` // microseconds
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args"`
+}
+
+// traceOut writes the recorded requests as a chrome trace event document,
+// which chrome://tracing and perfetto can open.
+func traceOut(w io.Writer, reqs []requestTiming, start time.Time) error {
+	doc := struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{TraceEvents: []traceEvent{}, DisplayTimeUnit: "ms"}
+	for _, r := range reqs {
+		doc.TraceEvents = append(doc.TraceEvents, traceEvent{
+			Name: r.Path,
+			Cat:  r.Op,
+			Ph:   "X",
+			Ts:   int64(r.Start.Sub(start) / time.Microsecond),
+			Dur:  int64(r.Duration / time.Microsecond),
+			Pid:  1,
+			Tid:  1,
+			Args: map[string]interface{}{"status": r.Status, "retries": r.Retries},
+		})
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// crawlTelemetry prints the timing summary and writes the trace file of the
+// crawl that just finished, as requested on the command line. Neither is
+// worth failing the run for, so errors are only logged.
+func crawlTelemetry() {
+	if timings {
+		timingText(os.Stderr, summarizeTimings(crawler.timings, crawler.duration, timingTop))
+	}
+	if traceFile == "" {
+		return
+	}
+	var b bytes.Buffer
+	err := traceOut(&b, crawler.timings, crawler.started)
+	if err == nil {
+		err = writeAtomic(traceFile, b.Bytes())
+	}
+	if err != nil {
+		syslogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"file":    traceFile,
+			"error":   err,
+		}).Error(`Could not write the trace file`)
+		txtlogLog.WithFields(logrus.Fields{
+			"app":     "vaultVisualize",
+			"version": version.AppVersion(),
+			"file":    traceFile,
+			"error":   err,
+		}).Error(`Could not write the trace file`)
+	}
+}
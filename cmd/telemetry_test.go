@@ -0,0 +1,120 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hashicorp/vault/api"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVaultRequest(t *testing.T) {
+
+	Convey("When listing paths on a vault that fails the first request", t, func() {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			switch {
+			case r.URL.Path == "/v1/secret/flaky" && calls == 1:
+				w.WriteHeader(500)
+			case r.URL.Path == "/v1/secret/flaky":
+				w.Write([]byte(`{"data": {"keys": ["a", "b/"]}}`))
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+		defer ts.Close()
+		cfg := api.DefaultConfig()
+		cfg.Address = ts.URL
+		cli, err := api.NewClient(cfg)
+		So(err, should.BeNil)
+		defer func(wait time.Duration) { retries, retryWait, crawler.timings, crawler.requests = 0, wait, nil, 0 }(retryWait)
+		retries, retryWait = 1, time.Millisecond
+		crawler.timings, crawler.requests = nil, 0
+
+		Convey("The request should be retried and recorded once", func() {
+			s, err := listKeys(cli, "secret/flaky")
+			So(err, should.BeNil)
+			So(s.Data["keys"], should.HaveLength, 2)
+			So(crawler.timings, should.HaveLength, 1)
+			So(crawler.timings[0].Op, should.Equal, "LIST")
+			So(crawler.timings[0].Status, should.Equal, 200)
+			So(crawler.timings[0].Retries, should.Equal, 1)
+			So(crawler.requests, should.Equal, 1)
+		})
+		Convey("A path without keys should not be an error", func() {
+			s, err := listKeys(cli, "secret/missing")
+			So(err, should.BeNil)
+			So(s, should.BeNil)
+			So(crawler.timings[0].Status, should.Equal, 404)
+		})
+	})
+}
+
+func TestTimingSummary(t *testing.T) {
+
+	Convey("When summarising the requests of a crawl", t, func() {
+		start := time.Unix(1500000000, 0)
+		var reqs []requestTiming
+		for i := 1; i <= 100; i++ {
+			reqs = append(reqs, requestTiming{Op: "LIST", Path: "secret/app", Status: 200, Start: start.Add(time.Duration(i) * time.Second), Duration: time.Duration(i) * time.Millisecond})
+		}
+		reqs = append(reqs, requestTiming{Op: "READ", Path: "sys/mounts", Status: 403, Start: start, Duration: time.Second, Retries: 2})
+		s := summarizeTimings(reqs, 10*time.Second, 2)
+
+		Convey("The percentiles should come from the sorted latencies", func() {
+			So(s.P50, should.Equal, 51*time.Millisecond)
+			So(s.P95, should.Equal, 96*time.Millisecond)
+			So(s.P99, should.Equal, 100*time.Millisecond)
+		})
+		Convey("The totals should count errors, retries and the request rate", func() {
+			So(s.Requests, should.Equal, 101)
+			So(s.Errors, should.Equal, 1)
+			So(s.Retries, should.Equal, 2)
+			So(s.PerSecond, should.AlmostEqual, 10.1, 0.001)
+		})
+		Convey("The slowest requests and the time per mount should be listed", func() {
+			So(s.Slowest[0].Path, should.Equal, "sys/mounts")
+			So(s.Slowest[1].Duration, should.Equal, 100*time.Millisecond)
+			So(s.Mounts, should.HaveLength, 2)
+			So(s.Mounts[0].Mount, should.Equal, "secret")
+			So(s.Mounts[0].Requests, should.Equal, 100)
+		})
+		Convey("The trace should hold one complete event per request", func() {
+			var b bytes.Buffer
+			So(traceOut(&b, reqs, start), should.BeNil)
+			var doc struct {
+				TraceEvents []traceEvent `json:"traceEvents"`
+			}
+			So(json.Unmarshal(b.Bytes(), &doc), should.BeNil)
+			So(doc.TraceEvents, should.HaveLength, 101)
+			So(doc.TraceEvents[0].Ph, should.Equal, "X")
+			So(doc.TraceEvents[0].Ts, should.Equal, 1000000)
+			So(doc.TraceEvents[0].Dur, should.Equal, 1000)
+		})
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	pth "path"
+	"strings"
+	"text/template"
+)
+
+// templateNode is the view of a secret handed to --format template.
+type templateNode struct {
+	Path        string
+	Name        string
+	Type        string // mount, folder or secret
+	Depth       int
+	Mount       string
+	Leaves      int // secrets at or below the node
+	Annotations map[string]string
+	Parent      *templateNode
+	Children    []*templateNode
+}
+
+// newTemplateNode converts the node and its visible children to their
+// template view.
+func newTemplateNode(v view, node *secret, parent *templateNode) *templateNode {
+	n := &templateNode{
+		Path:        node.path,
+		Name:        node.name(),
+		Type:        node.nodeType(),
+		Depth:       node.depth(),
+		Mount:       node.mount(),
+		Leaves:      node.leafCount(),
+		Annotations: node.annotations,
+		Parent:      parent,
+	}
+	for _, child := range v.children(node) {
+		n.Children = append(n.Children, newTemplateNode(v, child, n))
+	}
+	return n
+}
+
+// walkNodes returns the node and everything below it, parents first.
+func walkNodes(n *templateNode) []*templateNode {
+	out := []*templateNode{n}
+	for _, child := range n.Children {
+		out = append(out, walkNodes(child)...)
+	}
+	return out
+}
+
+// globNodes returns the nodes whose path matches the glob.
+func globNodes(pattern string, nodes []*templateNode) ([]*templateNode, error) {
+	var out []*templateNode
+	for _, n := range nodes {
+		ok, err := pth.Match(pattern, n.Path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// typeNodes returns a function keeping the nodes of a single type.
+func typeNodes(t string) func(nodes []*templateNode) []*templateNode {
+	return func(nodes []*templateNode) []*templateNode {
+		var out []*templateNode
+		for _, n := range nodes {
+			if n.Type == t {
+				out = append(out, n)
+			}
+		}
+		return out
+	}
+}
+
+// nodePaths returns the paths of the nodes.
+func nodePaths(nodes []*templateNode) []string {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		out[i] = n.Path
+	}
+	return out
+}
+
+// indentLines prefixes every line of s with n spaces.
+func indentLines(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// joinStrings joins the list with sep, taking the list last so it can be
+// piped in.
+func joinStrings(sep string, list []string) string {
+	return strings.Join(list, sep)
+}
+
+// templateFuncs are the helpers available to --format template and to
+// report templates.
+var templateFuncs = template.FuncMap{
+	"walk":     walkNodes,
+	"children": func(n *templateNode) []*templateNode { return n.Children },
+	"depth":    func(n *templateNode) int { return n.Depth },
+	"glob":     globNodes,
+	"secrets":  typeNodes("secret"),
+	"folders":  typeNodes("folder"),
+	"paths":    nodePaths,
+	"join":     joinStrings,
+	"indent":   indentLines,
+	"repeat":   strings.Repeat,
+	"trim":     func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"replace":  func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"md":       mdEscape,
+}
+
+// templateOut executes the --template file over the keyspace.
+func templateOut(w io.Writer, root *secret, v view) error {
+	if templateFile == "" {
+		return fmt.Errorf("the template format needs --template")
+	}
+	b, err := ioutil.ReadFile(templateFile)
+	if err != nil {
+		return err
+	}
+	t, err := template.New(pth.Base(templateFile)).Funcs(templateFuncs).Parse(string(b))
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, newTemplateNode(v, root, nil))
+}
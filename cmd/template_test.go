@@ -0,0 +1,84 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// runTemplate executes the template text over the test tree.
+func runTemplate(text string) (string, error) {
+	f, _ := ioutil.TempFile("", "tmpl")
+	defer os.Remove(f.Name())
+	f.WriteString(text)
+	f.Close()
+	templateFile = f.Name()
+	defer func() { templateFile = "" }()
+	var b bytes.Buffer
+	err := templateOut(&b, testTree(), view{})
+	return b.String(), err
+}
+
+func TestTemplateOut(t *testing.T) {
+
+	Convey("When the template builds an ansible style inventory", t, func() {
+		out, err := runTemplate(`{{range folders (walk .)}}[{{.Name}}]
+{{range secrets (children .)}}{{trim "secret/" .Path}}
+{{end}}{{end}}`)
+
+		Convey("Each folder should list its secrets", func() {
+			So(err, should.BeNil)
+			So(out, should.Equal, "[app-1]\napp-1/db\napp-1/api\n[ops]\nops/db\n")
+		})
+	})
+
+	Convey("When the template filters by glob and joins the paths", t, func() {
+		out, err := runTemplate(`{{glob "secret/*/db" (walk .) | paths | join ", "}}`)
+
+		Convey("Only the matching paths should be joined", func() {
+			So(err, should.BeNil)
+			So(out, should.Equal, "secret/app-1/db, secret/ops/db")
+		})
+	})
+
+	Convey("When the template indents by depth", t, func() {
+		out, _ := runTemplate(`{{range walk .}}{{indent (depth .) .Name}}
+{{end}}`)
+
+		Convey("Each line should be indented by its depth", func() {
+			So(out, should.StartWith, "secret\n app-1\n  db\n")
+		})
+	})
+
+	Convey("When no template file is given", t, func() {
+		templateFile = ""
+		err := templateOut(&bytes.Buffer{}, testTree(), view{})
+
+		Convey("An error should be returned", func() {
+			So(err, should.NotBeNil)
+		})
+	})
+}
@@ -0,0 +1,282 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	gph "github.com/awalterschulze/gographviz"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// theme maps properties of a node to the dot attributes used to draw it.
+// Attributes are applied in field order, so a path rule wins over the node
+// type, which wins over the mount, which wins over the depth.
+type theme struct {
+	ColorBy string                       `yaml:"color_by"` // depth, mount, type or access, coloured from colorMap
+	Base    map[string]string            `yaml:"base"`
+	Depth   []map[string]string          `yaml:"depth"` // indexed by depth, repeating when the tree is deeper
+	Mount   map[string]map[string]string `yaml:"mount"`
+	Type    map[string]map[string]string `yaml:"type"`
+	Rules   []themeRule                  `yaml:"rules"`
+
+	mounts   map[string]int // palette index of each mount, in order of first use
+	policies map[string]int // palette index of each policy, in order of first use
+	legend   []legendEntry  // everything that styled a node, in order of first use
+}
+
+// themeRule styles every node whose path matches a regular expression.
+type themeRule struct {
+	Match string            `yaml:"match"`
+	Label string            `yaml:"label"` // shown in the legend, defaults to the expression
+	Attrs map[string]string `yaml:"attrs"`
+
+	re *regexp.Regexp
+}
+
+// legendEntry is a single row of the legend subgraph.
+type legendEntry struct {
+	label string
+	attrs map[string]string
+}
+
+// themes are the built in themes selectable with --theme.
+var themes = map[string]theme{
+	"plain": {
+		Base: map[string]string{"style": "bold"},
+	},
+	"depth": {
+		ColorBy: "depth",
+		Base:    map[string]string{"style": "bold"},
+	},
+	"mount": {
+		ColorBy: "mount",
+		Base:    map[string]string{"style": "bold"},
+	},
+	"access": {
+		ColorBy: "access",
+		Base:    map[string]string{"style": "bold"},
+	},
+	"type": {
+		ColorBy: "type",
+		Base:    map[string]string{"style": "bold"},
+		Type: map[string]map[string]string{
+			"mount":  {"shape": "cylinder"},
+			"folder": {"shape": "folder"},
+			"secret": {"shape": "note"},
+		},
+	},
+}
+
+// loadTheme returns the built in theme with the given name, or reads the
+// theme from the yaml file at that path.
+func loadTheme(name string) (*theme, error) {
+	t, ok := themes[name]
+	if !ok {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a built in theme or a readable theme file: %s", name, err)
+		}
+		if err := yaml.Unmarshal(b, &t); err != nil {
+			return nil, fmt.Errorf("could not parse theme file %q: %s", name, err)
+		}
+	}
+	switch t.ColorBy {
+	case "", "depth", "mount", "type", "access":
+	default:
+		return nil, fmt.Errorf("unknown color_by %q in theme %q", t.ColorBy, name)
+	}
+	rules := make([]themeRule, len(t.Rules))
+	for i, r := range t.Rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("bad rule %q in theme %q: %s", r.Match, name, err)
+		}
+		r.re = re
+		if r.Label == "" {
+			r.Label = r.Match
+		}
+		rules[i] = r
+	}
+	t.Rules = rules
+	t.mounts = map[string]int{}
+	t.policies = map[string]int{}
+	t.legend = nil
+	return &t, nil
+}
+
+// dotQuote returns v as a quoted dot string, escaping backslashes and quotes
+// so that any key can be used as an id or label.
+func dotQuote(v string) string {
+	v = strings.Replace(v, "\\", "\\\\", -1)
+	return "\"" + strings.Replace(v, "\"", "\\\"", -1) + "\""
+}
+
+// themeValue returns the dot form of a value from a theme. Values the theme
+// marks with an html: prefix are written as html labels, everything else is
+// quoted.
+func themeValue(v string) string {
+	if strings.HasPrefix(v, "html:") {
+		return "<" + strings.TrimPrefix(v, "html:") + ">"
+	}
+	return dotQuote(v)
+}
+
+// paletteColor returns the colour at index i of colorMap without its quotes.
+func paletteColor(i int) string {
+	return strings.Trim(colorPick(i), "\"")
+}
+
+// typeIndex is the palette index used for each node type by color_by: type.
+var typeIndex = map[string]int{"mount": 0, "folder": 1, "secret": 2, "summary": 3}
+
+// addLegend records that label styled a node with attrs.
+func (t *theme) addLegend(label string, attrs map[string]string) {
+	for _, e := range t.legend {
+		if e.label == label {
+			for k, v := range attrs {
+				e.attrs[k] = v
+			}
+			return
+		}
+	}
+	e := legendEntry{label, map[string]string{}}
+	for k, v := range attrs {
+		e.attrs[k] = v
+	}
+	t.legend = append(t.legend, e)
+}
+
+// apply copies the attributes in from into the node attributes and, when any
+// were set, notes them in the legend under label.
+func (t *theme) apply(attrs, from map[string]string, label string) {
+	if len(from) == 0 {
+		return
+	}
+	for k, v := range from {
+		attrs[k] = v
+	}
+	t.addLegend(label, from)
+}
+
+// attrs returns the quoted dot attributes for the node.
+func (t *theme) attrs(node *secret) map[string]string {
+	attrs := map[string]string{}
+	for k, v := range t.Base {
+		attrs[k] = v
+	}
+
+	d := node.depth()
+	switch t.ColorBy {
+	case "depth":
+		t.apply(attrs, map[string]string{"color": paletteColor(d)}, "depth "+strconv.Itoa(d))
+	case "mount":
+		i, ok := t.mounts[node.mount()]
+		if !ok {
+			i = len(t.mounts)
+			t.mounts[node.mount()] = i
+		}
+		t.apply(attrs, map[string]string{"color": paletteColor(i)}, "mount "+node.mount())
+	case "type":
+		t.apply(attrs, map[string]string{"color": paletteColor(typeIndex[node.nodeType()])}, node.nodeType())
+	case "access":
+		if l := accessLevel(node); l != "" {
+			t.apply(attrs, map[string]string{"color": paletteColor(accessIndex[l])}, "access "+l)
+		}
+	}
+	if len(t.Depth) > 0 {
+		t.apply(attrs, t.Depth[d%len(t.Depth)], "depth "+strconv.Itoa(d))
+	}
+	t.apply(attrs, t.Mount[node.mount()], "mount "+node.mount())
+	t.apply(attrs, t.Type[node.nodeType()], node.nodeType())
+	for _, r := range t.Rules {
+		if r.re.MatchString(node.path) {
+			t.apply(attrs, r.Attrs, r.Label)
+		}
+	}
+
+	for k, v := range attrs {
+		attrs[k] = themeValue(v)
+	}
+	return attrs
+}
+
+// edgeAttrs returns the quoted dot attributes for the edge leading to the
+// node, coloured by each policy applied to the node and dashed when they
+// deny it.
+func (t *theme) edgeAttrs(node *secret) map[string]string {
+	attrs := map[string]string{}
+	if node.annotations["policies"] == "" {
+		return attrs
+	}
+	var colors []string
+	for _, p := range strings.Split(node.annotations["policies"], ",") {
+		i, ok := t.policies[p]
+		if !ok {
+			i = len(t.policies)
+			t.policies[p] = i
+		}
+		c := paletteColor(i)
+		colors = append(colors, c)
+		t.addLegend("policy "+p, map[string]string{"color": c})
+	}
+	attrs["color"] = dotQuote(strings.Join(colors, ":"))
+	if node.annotations["capabilities"] == "deny" {
+		attrs["style"] = dotQuote("dashed")
+	}
+	return attrs
+}
+
+// legendEntries returns the legend rows with their quoted dot attributes.
+func (t *theme) legendEntries() []legendEntry {
+	var out []legendEntry
+	for _, e := range t.legend {
+		attrs := map[string]string{}
+		for k, v := range t.Base {
+			attrs[k] = themeValue(v)
+		}
+		for k, v := range e.attrs {
+			attrs[k] = themeValue(v)
+		}
+		attrs["label"] = dotQuote(e.label)
+		out = append(out, legendEntry{e.label, attrs})
+	}
+	return out
+}
+
+// legendOut adds a legend subgraph to the graph with one node for every
+// style the theme applied.
+func legendOut(g *gph.Graph, t *theme) {
+	entries := t.legendEntries()
+	if len(entries) == 0 {
+		return
+	}
+	g.AddSubGraph("Vault", "cluster_legend", map[string]string{
+		"label": dotQuote("Legend"),
+		"style": dotQuote("dashed"),
+	})
+	for i, e := range entries {
+		g.AddNode("cluster_legend", dotQuote("legend_"+strconv.Itoa(i)), e.attrs)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadTheme(t *testing.T) {
+
+	Convey("When loading a theme from a yaml file", t, func() {
+		f, _ := ioutil.TempFile("", "theme")
+		defer os.Remove(f.Name())
+		f.WriteString("color_by: depth\ntype:\n  folder:\n    shape: folder\nrules:\n  - match: ^secret/ops\n    label: ops team\n    attrs:\n      fontsize: 18\n")
+		f.Close()
+		th, err := loadTheme(f.Name())
+
+		Convey("The theme should load without error", func() {
+			So(err, should.BeNil)
+		})
+		Convey("A path rule should win over the other settings", func() {
+			a := th.attrs(testTree().children[1])
+			So(a["fontsize"], should.Equal, "\"18\"")
+			So(a["shape"], should.Equal, "\"folder\"")
+			So(a["color"], should.Equal, colorPick(1))
+		})
+		Convey("Every style applied should be in the legend", func() {
+			th.attrs(testTree().children[1])
+			var labels []string
+			for _, e := range th.legendEntries() {
+				labels = append(labels, e.label)
+			}
+			So(labels, should.Resemble, []string{"depth 1", "folder", "ops team"})
+		})
+	})
+
+	Convey("When the theme is neither built in nor a file", t, func() {
+		_, err := loadTheme("no-such-theme")
+
+		Convey("An error should be returned", func() {
+			So(err, should.NotBeNil)
+		})
+	})
+}
+
+func TestDotQuote(t *testing.T) {
+
+	Convey("Keys should always be quoted with quotes and backslashes escaped", t, func() {
+		So(dotQuote("<b>"), should.Equal, `"<b>"`)
+		So(dotQuote(`a"b`), should.Equal, `"a\"b"`)
+		So(dotQuote(`key\`), should.Equal, `"key\\"`)
+		So(dotQuote(`"x"`), should.Equal, `"\"x\""`)
+	})
+
+	Convey("Only theme values marked html should become html labels", t, func() {
+		So(themeValue("html:<b>ops</b>"), should.Equal, "<<b>ops</b>>")
+		So(themeValue("<b>ops</b>"), should.Equal, `"<b>ops</b>"`)
+	})
+}
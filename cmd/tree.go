@@ -0,0 +1,97 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// treeColors maps a node type to the ansi escape used to draw it.
+var treeColors = map[string]string{
+	"mount":  "\x1b[1;35m",
+	"folder": "\x1b[1;34m",
+	"secret": "\x1b[32m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// useColor reports whether the tree should be coloured when written to w. In
+// auto mode colour is only used when w is a terminal.
+func useColor(w io.Writer) bool {
+	switch color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// treeOut prints the keyspace in the style of tree(1), with the number of
+// secrets below each folder and a summary line at the end.
+func treeOut(w io.Writer, root *secret, v view) error {
+	colored := useColor(w)
+	folders, leaves := 0, 0
+	var b bytes.Buffer
+
+	label := func(node *secret) string {
+		l := node.name()
+		if colored {
+			l = treeColors[node.nodeType()] + l + ansiReset
+		}
+		if node.nodeType() != "secret" {
+			l = fmt.Sprintf("%s (%d)", l, node.leafCount())
+		}
+		return l
+	}
+
+	var walk func(node *secret, prefix string)
+	walk = func(node *secret, prefix string) {
+		children := v.children(node)
+		for i, child := range children {
+			connector, indent := "├── ", "│   "
+			if i == len(children)-1 {
+				connector, indent = "└── ", "    "
+			}
+			if child.nodeType() == "secret" {
+				leaves++
+			} else {
+				folders++
+			}
+			fmt.Fprintf(&b, "%s%s%s\n", prefix, connector, label(child))
+			walk(child, prefix+indent)
+		}
+	}
+
+	fmt.Fprintln(&b, label(root))
+	walk(root, "")
+	fmt.Fprintf(&b, "\n%d folders, %d secrets\n", folders, leaves)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,60 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestTreeOut(t *testing.T) {
+
+	Convey("When printing the test tree to a buffer with the color mode on auto", t, func() {
+		color = "auto"
+		var b bytes.Buffer
+		treeOut(&b, testTree(), view{})
+
+		Convey("The output should match tree(1)", func() {
+			So(b.String(), should.Equal, "secret (3)\n"+
+				"├── app-1 (2)\n"+
+				"│   ├── db\n"+
+				"│   └── api\n"+
+				"└── ops (1)\n"+
+				"    └── db\n"+
+				"\n"+
+				"2 folders, 3 secrets\n")
+		})
+	})
+
+	Convey("When printing the test tree with the color mode on always", t, func() {
+		color = "always"
+		var b bytes.Buffer
+		treeOut(&b, testTree(), view{})
+		color = "auto"
+
+		Convey("Folders and secrets should be wrapped in their colours", func() {
+			So(b.String(), should.ContainSubstring, treeColors["folder"]+"ops"+ansiReset+" (1)")
+			So(b.String(), should.ContainSubstring, treeColors["secret"]+"db"+ansiReset)
+		})
+	})
+}
@@ -23,13 +23,10 @@ package cmd
 import (
 	"fmt"
 	"github.com/Sirupsen/logrus"
-	gph "github.com/awalterschulze/gographviz"
-	"github.com/hashicorp/vault/api"
 	"github.com/spf13/cobra"
 	"github.com/yieldbot/sensuplugin/sensuutil"
 	"github.com/yieldbot/vaultVisualize/version"
 	"os"
-	"strconv"
 )
 
 // vaultVisualizeCmd represents the vaultVisualize command
@@ -39,97 +36,54 @@ var vaultVisualizeCmd = &cobra.Command{
 	Long:  `Walk a vault tree and present a json blob or build a graphical representation of all keyspaces.`,
 	Run: func(vaultVisualize *cobra.Command, args []string) {
 
-		// Set the baseline config for the vault client
-		cfg := api.DefaultConfig()
-
-		// configure tls for the client using viper
-		tls := &api.TLSConfig{}
-		c, err := strconv.ParseBool(setCertMode())
+		// Check the requested formats before spending any time crawling
+		formats, err := formatList(format)
+		if err == nil && len(formats) > 1 && outputDir == "" {
+			err = fmt.Errorf("writing more than one format requires --output-dir")
+		}
+		if err == nil && paged != "" && outputDir == "" {
+			err = fmt.Errorf("--paged requires --output-dir")
+		}
 		if err != nil {
 			syslogLog.WithFields(logrus.Fields{
 				"app":     "vaultVisualize",
 				"version": version.AppVersion(),
+				"format":  format,
 				"error":   err,
-			}).Error(`Could not set cert verify mode`)
+			}).Error(`Could not use the requested output format`)
 			txtlogLog.WithFields(logrus.Fields{
 				"app":     "vaultVisualize",
 				"version": version.AppVersion(),
+				"format":  format,
 				"error":   err,
-			}).Error(`Could not set cert verify mode`)
+			}).Error(`Could not use the requested output format`)
 			sensuutil.Exit("CONFIGERROR")
 		}
-		tls.Insecure = c
-		cfg.ConfigureTLS(tls)
 
-		// Set the vault server address using consul and viper
-		cfg.Address = buildUrl()
-
-		// Create a client token
-		cli, err := api.NewClient(cfg)
-		if err != nil {
-			syslogLog.WithFields(logrus.Fields{
-				"app":     "vaultVisualize",
-				"version": version.AppVersion(),
-				"error":   err,
-			}).Error(`Could not create new client`)
-			txtlogLog.WithFields(logrus.Fields{
-				"app":     "vaultVisualize",
-				"version": version.AppVersion(),
-				"error":   err,
-			}).Error(`Could not create new client`)
-			sensuutil.Exit("GENERALGOLANGERROR")
+		root := loadTree()
+		if outFile != "" {
+			outputFile(root, outFile)
 		}
-
-		// Set the client auth token using viper
-		a := setAuth()
-		if a != "" {
-			cli.SetToken(a)
+		if outputDir != "" {
+			err = writeOutputDir(outputDir, formats, root, flagView())
 		} else {
-			cli.SetToken(os.Getenv("VAULT_TOKEN"))
+			err = render(formats[0], os.Stdout, root, flagView())
 		}
-
-		s, e := cli.Logical().List("secret")
-		if e != nil {
+		if err != nil {
 			syslogLog.WithFields(logrus.Fields{
 				"app":     "vaultVisualize",
 				"version": version.AppVersion(),
+				"format":  format,
 				"error":   err,
-			}).Error(`Could not list vault keys, check the path`)
+			}).Error(`Could not render the keyspace`)
 			txtlogLog.WithFields(logrus.Fields{
 				"app":     "vaultVisualize",
 				"version": version.AppVersion(),
+				"format":  format,
 				"error":   err,
-			}).Error(`Could not list vault keys, check the path`)
+			}).Error(`Could not render the keyspace`)
 			sensuutil.Exit("GENERALGOLANGERROR")
 		}
-		crawler.client = cli
-		root := secret{
-			path:     "secret",
-			parent:   nil,
-			children: nil,
-		}
-		secrets["secret"] = &root
-		keys := s.Data["keys"]
-		for _, key := range keys.([]interface{}) {
-			crawl(&root, key.(string))
-		}
-		rPath := root.path
-		graph := gph.NewGraph()
-		graph.SetDir(true)
-		graph.SetName("Vault")
-		ct := 0
-		for _, child := range root.children {
-			//outputSTD(child)
-			if outFile != "" {
-				outputFile(child, outFile)
-			}
-			fmt.Println(child)
-			graphOut(graph, child, rPath, ct)
-			ct = ct + 1
-
-		}
-		output := graph.String()
-		fmt.Println(output)
 
 	},
 }
@@ -0,0 +1,384 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+	"github.com/yieldbot/sensuplugin/sensuutil"
+	"github.com/yieldbot/vaultVisualize/version"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var verifyOffline bool      // Check the expectations against parsed policies only
+var verifyPolicies []string // Local policy files replacing the policies of the same name
+
+// expectation is a single entry of a verify file. The subject is exactly one
+// of Token, Accessor, TokenRole, Role or Policies.
+type expectation struct {
+	Name      string   `yaml:"name"`
+	Token     string   `yaml:"token"` // environment variables are expanded
+	Accessor  string   `yaml:"accessor"`
+	TokenRole string   `yaml:"token_role"` // name of a role below auth/token/roles
+	Role      string   `yaml:"role"`       // full path of an auth method role, e.g. auth/approle/role/web
+	Policies  []string `yaml:"policies"`
+	Path      string   `yaml:"path"`
+	Paths     []string `yaml:"paths"` // globs are expanded against the keyspace
+	Can       []string `yaml:"can"`
+	Cannot    []string `yaml:"cannot"`
+}
+
+// verifyFile is the layout of the expectations file.
+type verifyFile struct {
+	Expectations []expectation `yaml:"expectations"`
+}
+
+// verifyResult is the outcome of checking one capability on one path.
+type verifyResult struct {
+	Expectation string
+	Path        string
+	Capability  string
+	Want        bool
+	Got         []string
+	Err         string
+}
+
+// Passed reports whether the subject's capabilities were as expected.
+func (r verifyResult) Passed() bool {
+	if r.Err != "" {
+		return false
+	}
+	has := false
+	for _, c := range r.Got {
+		has = has || c == r.Capability
+	}
+	return has == r.Want
+}
+
+// verifier checks expectations, against vault through cli unless offline.
+type verifier struct {
+	cli      *api.Client
+	offline  bool
+	policies map[string]*aclPolicy
+	tree     func() *secret // loads the keyspace when a path glob needs it
+}
+
+// subject names the expectation's subject for the report.
+func (e expectation) subject() string {
+	switch {
+	case e.Name != "":
+		return e.Name
+	case e.Token != "":
+		return "token"
+	case e.Accessor != "":
+		return "accessor " + e.Accessor
+	case e.TokenRole != "":
+		return "token role " + e.TokenRole
+	case e.Role != "":
+		return e.Role
+	}
+	return "policies " + strings.Join(e.Policies, ",")
+}
+
+// hasGlob reports whether the path needs expanding against the keyspace.
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// paths returns the acl paths the expectation is about. Globs are matched
+// against the keyspace, other paths are used as written, so folders need
+// their trailing slash.
+func (v *verifier) paths(e expectation) ([]string, error) {
+	var out []string
+	for _, p := range append([]string{e.Path}, e.Paths...) {
+		p = strings.TrimPrefix(p, "/")
+		if p == "" {
+			continue
+		}
+		if !hasGlob(p) {
+			out = append(out, p)
+			continue
+		}
+		if v.tree == nil {
+			return nil, fmt.Errorf("%s needs a keyspace to expand", p)
+		}
+		found := false
+		var walk func(n *secret)
+		walk = func(n *secret) {
+			if selectMatch(p, n.path) {
+				out = append(out, n.aclPath())
+				found = true
+			}
+			for _, child := range n.children {
+				walk(child)
+			}
+		}
+		walk(v.tree())
+		if !found {
+			return nil, fmt.Errorf("%s matches no path", p)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no path given")
+	}
+	return out, nil
+}
+
+// rolePolicies reads the policies an auth method or token role attaches,
+// including default unless the role leaves it out.
+func (v *verifier) rolePolicies(path string) ([]string, error) {
+	if v.offline {
+		return nil, fmt.Errorf("looking up %s needs vault", path)
+	}
+	s, err := v.cli.Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, fmt.Errorf("%s does not exist", path)
+	}
+	var out []string
+	for _, f := range []string{"token_policies", "policies"} {
+		out = append(out, stringList(s.Data[f])...)
+	}
+	if getsDefault("", s.Data) {
+		out = append(out, "default")
+	}
+	return out, nil
+}
+
+// capabilitiesFunc returns how to look up the subject's capabilities on a
+// path: asking vault for tokens and accessors, evaluating the policies
+// otherwise.
+func (v *verifier) capabilitiesFunc(e expectation) (func(string) ([]string, error), error) {
+	if e.Token != "" || e.Accessor != "" {
+		if v.offline {
+			return nil, fmt.Errorf("checking a token needs vault")
+		}
+		c := newCapabilityChecker(v.cli, os.ExpandEnv(e.Token), e.Accessor)
+		return func(p string) ([]string, error) {
+			caps, err := c.request([]string{p})
+			return caps[p], err
+		}, nil
+	}
+	names := e.Policies
+	var err error
+	switch {
+	case e.TokenRole != "":
+		names, err = v.rolePolicies("auth/token/roles/" + e.TokenRole)
+	case e.Role != "":
+		names, err = v.rolePolicies(strings.Trim(e.Role, "/"))
+	case len(names) == 0:
+		err = fmt.Errorf("no token, accessor, token_role, role or policies given")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var set []*aclPolicy
+	for _, n := range names {
+		if n == "root" {
+			return func(string) ([]string, error) { return tokenCapabilities([]string{"root"}), nil }, nil
+		}
+		p, ok := v.policies[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown policy %q", n)
+		}
+		set = append(set, p)
+	}
+	return func(p string) ([]string, error) {
+		return effectiveCapabilities(policyGrants(set, p)), nil
+	}, nil
+}
+
+// check verifies a single expectation, one result per path and capability.
+// An expectation checking nothing, or an unknown capability, is a failure.
+func (v *verifier) check(e expectation) []verifyResult {
+	fail := func(err error) []verifyResult {
+		return []verifyResult{{Expectation: e.subject(), Path: e.Path, Err: err.Error()}}
+	}
+	if len(e.Can) == 0 && len(e.Cannot) == 0 {
+		return fail(fmt.Errorf("no can or cannot given"))
+	}
+	for _, c := range append(append([]string{}, e.Can...), e.Cannot...) {
+		if capabilityRank(c) < 0 {
+			return fail(fmt.Errorf("unknown capability %q", c))
+		}
+	}
+	paths, err := v.paths(e)
+	if err != nil {
+		return fail(err)
+	}
+	capsOn, err := v.capabilitiesFunc(e)
+	if err != nil {
+		return fail(err)
+	}
+	var out []verifyResult
+	for _, p := range paths {
+		got, err := capsOn(p)
+		r := verifyResult{Expectation: e.subject(), Path: p, Got: got}
+		if err != nil {
+			r.Err = err.Error()
+		}
+		for _, c := range e.Can {
+			r.Capability, r.Want = c, true
+			out = append(out, r)
+		}
+		for _, c := range e.Cannot {
+			r.Capability, r.Want = c, false
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// verifyText writes a line per result and a summary, returning the number
+// of failures.
+func verifyText(w io.Writer, results []verifyResult) (int, error) {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	failed := 0
+	for _, r := range results {
+		status, verb := "PASS", "can"
+		if !r.Passed() {
+			status = "FAIL"
+			failed++
+		}
+		if !r.Want {
+			verb = "cannot"
+		}
+		detail := "has " + strings.Join(r.Got, ",")
+		if r.Err != "" {
+			detail = r.Err
+		}
+		fmt.Fprintf(tw, "%s\t%s %s %s %s\t%s\n", status, r.Expectation, verb, r.Capability, r.Path, detail)
+	}
+	fmt.Fprintf(tw, "\n%d passed, %d failed\n", len(results)-failed, failed)
+	tw.Flush()
+	_, err := io.WriteString(w, b.String())
+	return failed, err
+}
+
+// loadVerifier builds the verifier for the flags given: the policies come from
+// the snapshot or vault, replaced by any --policy-file.
+func loadVerifier() (*verifier, error) {
+	v := &verifier{offline: verifyOffline, policies: map[string]*aclPolicy{}}
+	if snapshot != "" {
+		root, err := loadSnapshot(snapshot)
+		if err != nil {
+			return nil, err
+		}
+		v.tree = func() *secret { return root }
+	} else if !v.offline {
+		var root *secret
+		v.tree = func() *secret {
+			if root == nil {
+				root = readTree()
+			}
+			return root
+		}
+	}
+	if !v.offline {
+		v.cli = vaultClient()
+	}
+	if len(crawler.policies) == 0 && !v.offline {
+		p, err := fetchPolicies(v.cli)
+		if err != nil {
+			return nil, err
+		}
+		crawler.policies = p
+	}
+	for _, p := range crawler.policies {
+		v.policies[p.Name] = p
+	}
+	for _, f := range verifyPolicies {
+		p, err := policyFile(f)
+		if err != nil {
+			return nil, err
+		}
+		v.policies[p.Name] = p
+	}
+	return v, nil
+}
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <expectations.yaml>",
+	Short: "Check ACL expectations and fail when any is not met",
+	Long: `Read a yaml file of expectations, each giving a subject (token, accessor, token_role, role or policies),
+paths and the capabilities it can or cannot have on them, and check every one. Tokens and accessors are checked with
+vault's sys/capabilities; roles are looked up and, like policies, evaluated against the parsed policies. --offline
+checks policies against a --snapshot and --policy-file without vault. Exits non-zero when anything fails.`,
+	Run: func(verify *cobra.Command, args []string) {
+		var failed int
+		var err error
+		var f verifyFile
+		if len(args) != 1 {
+			err = fmt.Errorf("verify takes exactly one expectations file")
+		}
+		if err == nil {
+			var b []byte
+			if b, err = ioutil.ReadFile(args[0]); err == nil {
+				err = yaml.Unmarshal(b, &f)
+			}
+		}
+		var v *verifier
+		if err == nil {
+			v, err = loadVerifier()
+		}
+		if err == nil {
+			var results []verifyResult
+			for _, e := range f.Expectations {
+				results = append(results, v.check(e)...)
+			}
+			failed, err = verifyText(os.Stdout, results)
+		}
+		if err != nil {
+			syslogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"error":   err,
+			}).Error(`Could not verify the expectations`)
+			txtlogLog.WithFields(logrus.Fields{
+				"app":     "vaultVisualize",
+				"version": version.AppVersion(),
+				"error":   err,
+			}).Error(`Could not verify the expectations`)
+			sensuutil.Exit("GENERALGOLANGERROR")
+		}
+		if failed > 0 {
+			sensuutil.Exit("CRITICAL")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().BoolVar(&verifyOffline, "offline", false, "check policies against the --snapshot and --policy-file only, without vault")
+	verifyCmd.Flags().StringSliceVar(&verifyPolicies, "policy-file", nil, "local policy file replacing the policy named after it, may be repeated")
+}
@@ -0,0 +1,132 @@
+// Copyright © 2017 Yieldbot <devops@yieldbot.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hashicorp/vault/api"
+	"github.com/smartystreets/assertions/should"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testExpectations = `
+expectations:
+  - name: web app
+    policies: [web]
+    paths: [secret/web/*]
+    can: [read]
+  - policies: [web]
+    path: secret/db/
+    cannot: [list]
+  - policies: [web]
+    path: secret/db/password
+    can: [read]
+  - policies: [missing]
+    path: secret/web/a
+    can: [read]
+  - token_role: web
+    path: secret/web/a
+    can: [read]
+  - policies: [web]
+    path: secret/web/a
+    cannot: [raed]
+  - policies: [web]
+    path: secret/web/a
+`
+
+func TestVerify(t *testing.T) {
+
+	Convey("When verifying expectations offline", t, func() {
+		var f verifyFile
+		So(yaml.Unmarshal([]byte(testExpectations), &f), should.BeNil)
+		web, _ := parsePolicy("web", `path "secret/web/*" { capabilities = ["read", "list"] }`)
+		root := buildTree("secret/web/", "secret/web/a", "secret/web/b", "secret/db/", "secret/db/password")
+		v := &verifier{offline: true, policies: map[string]*aclPolicy{"web": web}, tree: func() *secret { return root }}
+		var results []verifyResult
+		for _, e := range f.Expectations {
+			results = append(results, v.check(e)...)
+		}
+
+		Convey("Path globs should be expanded against the keyspace", func() {
+			So(results[0].Path, should.Equal, "secret/web/a")
+			So(results[1].Path, should.Equal, "secret/web/b")
+			So(results[0].Expectation, should.Equal, "web app")
+			So(results[0].Passed(), should.BeTrue)
+		})
+		Convey("Cannot expectations should pass when the capability is missing", func() {
+			So(results[2].Passed(), should.BeTrue)
+		})
+		Convey("Missing capabilities, unknown policies and role lookups should fail", func() {
+			So(results[3].Passed(), should.BeFalse)
+			So(results[4].Err, should.ContainSubstring, "unknown policy")
+			So(results[5].Err, should.ContainSubstring, "needs vault")
+		})
+		Convey("Unknown capabilities and expectations checking nothing should fail", func() {
+			So(results[6].Err, should.ContainSubstring, "unknown capability \"raed\"")
+			So(results[7].Err, should.ContainSubstring, "no can or cannot")
+		})
+		Convey("The report should count the failures", func() {
+			var b bytes.Buffer
+			failed, err := verifyText(&b, results)
+			So(err, should.BeNil)
+			So(failed, should.Equal, 5)
+			So(b.String(), should.StartWith, "PASS  web app can read secret/web/a")
+			So(b.String(), should.EndWith, "3 passed, 5 failed\n")
+		})
+	})
+
+	Convey("When verifying a token role and a token against vault", t, func() {
+		requests := 0
+		caps := capabilityServer(true, &requests)
+		defer caps.Close()
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/auth/token/roles/web" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"allowed_policies": []string{"admin"}, "token_policies": []string{"web"}}})
+				return
+			}
+			caps.Config.Handler.ServeHTTP(w, r)
+		}))
+		defer ts.Close()
+		cfg := api.DefaultConfig()
+		cfg.Address = ts.URL
+		cli, _ := api.NewClient(cfg)
+		web, _ := parsePolicy("web", `path "secret/web/*" { capabilities = ["read"] }`)
+		def, _ := parsePolicy("default", `path "secret/web/a" { capabilities = ["deny"] }`)
+		v := &verifier{cli: cli, policies: map[string]*aclPolicy{"web": web, "default": def}}
+
+		Convey("The role's policies, with default, should be evaluated", func() {
+			r := v.check(expectation{TokenRole: "web", Paths: []string{"secret/web/a", "secret/web/b"}, Can: []string{"read"}})
+			So(r[0].Got, should.Resemble, []string{"deny"})
+			So(r[1].Passed(), should.BeTrue)
+		})
+		Convey("Tokens should be checked with vault", func() {
+			r := v.check(expectation{Token: "app-token", Path: "secret/app/db", Can: []string{"read"}, Cannot: []string{"update"}})
+			So(r, should.HaveLength, 2)
+			So(r[0].Passed(), should.BeTrue)
+			So(r[1].Passed(), should.BeTrue)
+		})
+	})
+}